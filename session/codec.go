@@ -0,0 +1,260 @@
+package session
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Codec serializes the values of SessionAttributes.
+//
+// Encoded attributes start with the ID of their codec, so the codec of a
+// provider can be changed while the sessions saved with the previous one
+// are still read. Data without this header byte is from before codecs and
+// decoded with gob.
+type Codec interface {
+	// ID is the header byte, unique among the registered codecs.
+	ID() byte
+	Name() string
+	Marshal(kv map[string]interface{}) ([]byte, error)
+	Unmarshal(data []byte) (map[string]interface{}, error)
+}
+
+// Header bytes of the built-in codecs. They can't be the first byte of a
+// gob stream, so data saved before codecs is recognized.
+const (
+	GobCodecID     = byte(0x81)
+	JSONCodecID    = byte(0x82)
+	MsgpackCodecID = byte(0x83)
+)
+
+var (
+	// GobCodec keeps the Go types of the values, which must be registered
+	// with gob.Register before sessions holding them are loaded.
+	GobCodec Codec = gobCodec{}
+	// JSONCodec is readable by any tool, but numbers are decoded as float64,
+	// and structs as map[string]interface{}.
+	JSONCodec Codec = jsonCodec{}
+	// MsgpackCodec is compact and readable by other languages. It supports
+	// nil, booleans, numbers, strings, []byte, time.Time, and slices and
+	// string keyed maps of them; integers are decoded as int64, or uint64
+	// above math.MaxInt64.
+	MsgpackCodec Codec = msgpackCodec{}
+
+	// DefaultCodec is the codec of the providers with none set. It's read
+	// without lock, change it before serving.
+	DefaultCodec = GobCodec
+)
+
+// codecValue holds the codec of a provider or of attributes, their SetCodec
+// may be called while sessions are saved.
+type codecValue struct {
+	v atomic.Value
+}
+
+// codecBox gives the stored codecs a single type, as atomic.Value requires.
+type codecBox struct {
+	c Codec
+}
+
+func (cv *codecValue) Store(c Codec) {
+	cv.v.Store(codecBox{c})
+}
+
+// Load returns the codec, nil for DefaultCodec.
+func (cv *codecValue) Load() Codec {
+	b, _ := cv.v.Load().(codecBox)
+	return b.c
+}
+
+var (
+	codecs     = map[byte]Codec{}
+	codecsLock sync.RWMutex
+)
+
+func init() {
+	RegisterCodec(GobCodec)
+	RegisterCodec(JSONCodec)
+	RegisterCodec(MsgpackCodec)
+}
+
+// RegisterCodec makes a codec known to DecodeAttributes. It panics if the
+// ID is taken by another codec, or could start a gob stream.
+func RegisterCodec(c Codec) {
+	id := c.ID()
+	if id < 0x80 || id >= 0xF0 {
+		panic(fmt.Sprintf("session: codec %s: ID 0x%02x not in [0x80, 0xF0)", c.Name(), id))
+	}
+	codecsLock.Lock()
+	defer codecsLock.Unlock()
+	if other, ok := codecs[id]; ok && other.Name() != c.Name() {
+		panic(fmt.Sprintf("session: codec %s: ID 0x%02x used by %s", c.Name(), id, other.Name()))
+	}
+	codecs[id] = c
+}
+
+// DecodeError is returned when encoded attributes can't be decoded.
+type DecodeError struct {
+	// Name of the codec, "" if the header is unknown.
+	Codec string
+	Err   error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Codec == "" {
+		return "session: decode attributes: " + e.Err.Error()
+	}
+	return "session: decode attributes with " + e.Codec + " codec: " + e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// EncodeAttributes encodes kv with c, DefaultCodec if nil, after its header
+// byte.
+func EncodeAttributes(c Codec, kv map[string]interface{}) ([]byte, error) {
+	if c == nil {
+		c = DefaultCodec
+	}
+	data, err := c.Marshal(kv)
+	if err != nil {
+		return nil, fmt.Errorf("session: encode attributes with %s codec: %v", c.Name(), err)
+	}
+	return append([]byte{c.ID()}, data...), nil
+}
+
+// DecodeAttributes decodes data encoded with any registered codec, or with
+// EncodeGob for data without header. Errors are *DecodeError.
+func DecodeAttributes(data []byte) (map[string]interface{}, error) {
+	if len(data) == 0 {
+		return map[string]interface{}{}, nil
+	}
+	if data[0] < 0x80 || data[0] >= 0xF0 {
+		kv, err := DecodeGob(data)
+		if err != nil {
+			return nil, &DecodeError{Codec: "gob (no header)", Err: gobHint(err)}
+		}
+		return kv, nil
+	}
+	codecsLock.RLock()
+	c, ok := codecs[data[0]]
+	codecsLock.RUnlock()
+	if !ok {
+		return nil, &DecodeError{Err: fmt.Errorf("unknown codec header 0x%02x", data[0])}
+	}
+	kv, err := c.Unmarshal(data[1:])
+	if err != nil {
+		if c.ID() == GobCodecID {
+			err = gobHint(err)
+		}
+		return nil, &DecodeError{Codec: c.Name(), Err: err}
+	}
+	if kv == nil {
+		kv = map[string]interface{}{}
+	}
+	return kv, nil
+}
+
+// ----------------------------------------------------------------------------
+// gob
+// ----------------------------------------------------------------------------
+
+type gobCodec struct{}
+
+// gobTypes are the types already given to gob.Register.
+var gobTypes sync.Map
+
+func (gobCodec) ID() byte     { return GobCodecID }
+func (gobCodec) Name() string { return "gob" }
+
+func (gobCodec) Marshal(kv map[string]interface{}) ([]byte, error) {
+	for _, v := range kv {
+		if v == nil {
+			continue
+		}
+		if _, loaded := gobTypes.LoadOrStore(reflect.TypeOf(v), true); !loaded {
+			gob.Register(v)
+		}
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := gob.NewEncoder(buf).Encode(kv); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte) (map[string]interface{}, error) {
+	return DecodeGob(data)
+}
+
+// gobHint explains the most common gob error, a type saved before a restart
+// and not registered yet.
+func gobHint(err error) error {
+	if strings.Contains(err.Error(), "type not registered") {
+		return fmt.Errorf("%v (register the type with gob.Register before loading sessions)", err)
+	}
+	return err
+}
+
+// ----------------------------------------------------------------------------
+// json
+// ----------------------------------------------------------------------------
+
+type jsonCodec struct{}
+
+func (jsonCodec) ID() byte     { return JSONCodecID }
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(kv map[string]interface{}) ([]byte, error) {
+	return json.Marshal(kv)
+}
+
+func (jsonCodec) Unmarshal(data []byte) (map[string]interface{}, error) {
+	var kv map[string]interface{}
+	if err := json.Unmarshal(data, &kv); err != nil {
+		return nil, err
+	}
+	return kv, nil
+}
+
+// ----------------------------------------------------------------------------
+// msgpack
+// ----------------------------------------------------------------------------
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ID() byte     { return MsgpackCodecID }
+func (msgpackCodec) Name() string { return "msgpack" }
+
+func (msgpackCodec) Marshal(kv map[string]interface{}) ([]byte, error) {
+	var e msgpackEncoder
+	if err := e.encode(reflect.ValueOf(kv)); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte) (map[string]interface{}, error) {
+	d := msgpackDecoder{data: data}
+	v, err := d.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, fmt.Errorf("%d trailing bytes", len(d.data)-d.pos)
+	}
+	if v == nil {
+		return nil, nil
+	}
+	kv, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("not a map but %T", v)
+	}
+	return kv, nil
+}
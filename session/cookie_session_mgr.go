@@ -1,9 +1,11 @@
 package session
 
 import (
-	"crypto/md5"
 	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -20,14 +22,40 @@ type SessionMgrUsingCookie struct {
 	provider         SessionProvider
 	httpOnly         bool
 	domain           string
-	Secure           bool   //为true时,只有https才传递到服务器端。http是不会传递的
-	HashFuncName     string //support md5 & sha1
-	HashKey          string //
-	MaxAge           int64  //0表示不设置、-1表示立即删除、其他表示多少秒
+	Secure           bool      //为true时,只有https才传递到服务器端。http是不会传递的
+	HashFuncName     string    //md5, sha1, sha256 (默认) 或 sha512
+	HashKey          string    //不为空时, sid cookie 带 HMAC 签名, 见 SetSessionCookie; 不少于 MinHashKeyLen 字节
+	OldHashKeys      []string  //换 HashKey 后, 仍接受用这些旧 key 签名的 cookie, 用户不会被登出
+	UnsignedUntil    time.Time //设置 HashKey 后, 此时间之前仍接受未签名的 sid cookie, 已登录用户不会被登出; 为零值时不接受
+	MaxAge           int64     //0表示不设置、-1表示立即删除、其他表示多少秒
+	SidBytes         int       //sid 随机字节数, 不少于 MinSidBytes
+	SidEncoding      SidEncoding
+	NewSession       func(sid string, attrs SessionAttributes) Session //RegenerateSessionID 和 Middleware 用来创建 Session, 为 nil 时用最简单的 Session
+	Sliding          bool                                              //为true时, Middleware 每次请求都刷新 cookie 的过期时间
 	gcIntervalMinute int64
 	lock             sync.RWMutex
 }
 
+// MinSidBytes is the minimum number of random bytes of a sid, 128 bits.
+const MinSidBytes = 16
+
+// MinHashKeyLen is the minimum length of HashKey and OldHashKeys.
+const MinHashKeyLen = 32
+
+var ErrNoSession = errors.New("session: no session")
+
+// SidEncoding encodes the random bytes of a sid, the result must be a valid
+// cookie value and file name.
+type SidEncoding func(b []byte) string
+
+var (
+	SidHex       SidEncoding = hex.EncodeToString
+	SidBase64URL SidEncoding = base64.RawURLEncoding.EncodeToString
+	SidBase32    SidEncoding = func(b []byte) string {
+		return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+	}
+)
+
 func isLocalHost(host string) bool {
 	return strings.HasPrefix(host, "localhost") || strings.HasPrefix(host, "127.0.0.1") || strings.HasPrefix(host, "192.168.")
 }
@@ -46,6 +74,16 @@ func normalizeCookieDomain(domain string) string {
 	return cookieDomain
 }
 
+// NewSessionMgrUsingCookie returns a manager writing the sid in the cookie
+// cookieName, unsigned until HashKey is set.
+//
+// Once HashKey is set, the unsigned cookies given out before are rejected, so
+// their users are logged out, unless UnsignedUntil is set too: until then they
+// are still accepted, and signed the next time the cookie is written. Set it
+// to the session timeout from the upgrade, for example:
+//
+//     mgr.HashKey = key
+//     mgr.UnsignedUntil = time.Now().Add(time.Duration(provider.TimeoutSeconds()) * time.Second)
 func NewSessionMgrUsingCookie(sessionProvider SessionProvider, cookieName string, maxage int64, domain string, disableJsAccess bool, onlyUseHttps bool) (*SessionMgrUsingCookie, error) {
 	provider := sessionProvider
 
@@ -57,6 +95,8 @@ func NewSessionMgrUsingCookie(sessionProvider SessionProvider, cookieName string
 		MaxAge:           maxage,
 		Secure:           onlyUseHttps,
 		gcIntervalMinute: 60,
+		SidBytes:         MinSidBytes,
+		SidEncoding:      SidHex,
 		//HashFuncName: "sha1",
 		//HashKey:      "changethedefaultkey",
 	}, nil
@@ -72,18 +112,85 @@ func (manager *SessionMgrUsingCookie) SetCookieDomain(domain string) {
 
 //get SessionCookie, is sid
 func (manager *SessionMgrUsingCookie) GetSessionCookie(r *http.Request) (string, error) {
+	sid, _, err := manager.sessionCookie(r)
+	return sid, err
+}
+
+// sessionCookie returns the sid of the request cookie, and whether it was
+// accepted unsigned, before UnsignedUntil.
+func (manager *SessionMgrUsingCookie) sessionCookie(r *http.Request) (string, bool, error) {
 	//fmt.Printf("GetSessionCookie, manager.cookieName=%s\n", manager.cookieName)
 	cookie, err := r.Cookie(manager.cookieName)
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
 	//fmt.Printf("GetSessionCookie, cookie=%#v\n", *cookie)
 
-	return cookie.Value, nil
+	signer, err := manager.sidSigner()
+	if err != nil || signer == nil {
+		return cookie.Value, false, err
+	}
+	i := strings.LastIndexByte(cookie.Value, '.')
+	if i < 0 {
+		if time.Now().Before(manager.UnsignedUntil) {
+			// Set before HashKey, the cookie is signed the next time it's written.
+			return cookie.Value, true, nil
+		}
+		return "", false, ErrInvalidCookieValue
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(cookie.Value[i+1:])
+	if err != nil {
+		return "", false, ErrInvalidCookieValue
+	}
+	sid, _, ok := signer.verify(append([]byte(cookie.Value[:i]), sum...))
+	if !ok {
+		return "", false, ErrInvalidCookieValue
+	}
+	return string(sid), false, nil
+}
+
+// sidSigner returns the signer of the sid cookie, nil if HashKey is empty or
+// the provider signs the cookie itself.
+func (manager *SessionMgrUsingCookie) sidSigner() (*cookieSigner, error) {
+	if manager.HashKey == "" {
+		return nil, nil
+	}
+	if _, ok := manager.provider.(*CookieSessionProvider); ok {
+		return nil, nil
+	}
+	keys := append([]string{manager.HashKey}, manager.OldHashKeys...)
+	for _, key := range keys {
+		if len(key) < MinHashKeyLen {
+			return nil, fmt.Errorf("session: sid cookie keys must be at least %d bytes", MinHashKeyLen)
+		}
+	}
+	return newCookieSigner(manager.HashFuncName, keys)
+}
+
+// SaveSession writes the session cookie. With a CookieSessionProvider the
+// cookie holds the whole session, so it must be saved after each change of
+// the attributes; with other providers it holds the sid.
+func (manager *SessionMgrUsingCookie) SaveSession(w http.ResponseWriter, sxn Session) error {
+	value := sxn.SessionID()
+	if p, ok := manager.provider.(*CookieSessionProvider); ok {
+		var err error
+		if value, err = p.Seal(sxn); err != nil {
+			return err
+		}
+	}
+	manager.SetSessionCookie(w, value)
+	return nil
 }
 
-//set session cookie
+//set session cookie, signed with HashKey if set
 func (manager *SessionMgrUsingCookie) SetSessionCookie(w http.ResponseWriter, sid string) {
+	if signer, err := manager.sidSigner(); err != nil {
+		logger().Errorf("fail to sign session cookie, err=%v", err)
+		return
+	} else if signer != nil {
+		signed := signer.sign([]byte(sid))
+		sid += "." + base64.RawURLEncoding.EncodeToString(signed[len(sid):])
+	}
 	cookie := &http.Cookie{
 		Name:     manager.cookieName,
 		Value:    url.QueryEscape(sid),
@@ -160,6 +267,12 @@ func (manager *SessionMgrUsingCookie) GetSession(sid string) (Session, error) {
 	return manager.provider.GetSession(sid)
 }
 
+// HasSession reports whether the provider holds the session sid, without
+// updating its last access time.
+func (manager *SessionMgrUsingCookie) HasSession(sid string) (bool, error) {
+	return manager.provider.HasSession(sid)
+}
+
 //get Session By sessionId
 func (manager *SessionMgrUsingCookie) AddNewSession(sw Session) error {
 	return manager.provider.AddNewSession(sw)
@@ -180,31 +293,91 @@ func (manager *SessionMgrUsingCookie) GC() {
 	time.AfterFunc(time.Duration(manager.gcIntervalMinute)*time.Minute, func() { manager.GC() })
 }
 
-//remote_addr cruunixnano randdata
+// NewSessionId returns a session ID made of SidBytes random bytes from
+// crypto/rand, encoded with SidEncoding, "" if the random source fails. See
+// NewSessionIdErr for the error.
 func (manager *SessionMgrUsingCookie) NewSessionId(r *http.Request) string {
-	const randlen int = 12
-	randbb := make([]byte, randlen)
-	if _, err := io.ReadFull(rand.Reader, randbb); err != nil {
+	sid, err := manager.NewSessionIdErr(r)
+	if err != nil {
+		logger().Errorf("%v", err)
 		return ""
 	}
+	return sid
+}
+
+// NewSessionIdErr is NewSessionId returning an error, never a weak ID, if the
+// random source fails.
+func (manager *SessionMgrUsingCookie) NewSessionIdErr(r *http.Request) (string, error) {
+	n := manager.SidBytes
+	if n < MinSidBytes {
+		n = MinSidBytes
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", fmt.Errorf("session: fail to generate sid: %v", err)
+	}
+	encode := manager.SidEncoding
+	if encode == nil {
+		encode = SidHex
+	}
+	return encode(b), nil
+}
+
+// RegenerateSessionID moves the attributes of the request session to a new
+// sid, removes the old sid from the provider and rewrites the cookie. Call it
+// when the privileges change, on login, to prevent session fixation.
+//
+// It returns ErrNoSession if the request has no valid session.
+func (manager *SessionMgrUsingCookie) RegenerateSessionID(w http.ResponseWriter, r *http.Request) (Session, error) {
+	sid, err := manager.GetSessionCookie(r)
+	if err != nil || sid == "" {
+		return nil, ErrNoSession
+	}
+	old, err := manager.provider.GetSession(sid)
+	if err != nil {
+		return nil, err
+	}
+	if old == nil || old.Attributes() == nil {
+		return nil, ErrNoSession
+	}
+	sxn, err := manager.regenerate(r, sid, old)
+	if err != nil {
+		return nil, err
+	}
+	if err := manager.SaveSession(w, sxn); err != nil {
+		return nil, err
+	}
+	return sxn, nil
+}
 
-	sig := fmt.Sprintf("%s%d", r.RemoteAddr, time.Now().UnixNano())
-	signbytes := []byte(sig)
-	signlen := len(signbytes)
-	h := md5.New()
-	n, _ := h.Write(signbytes)
-	for n < signlen {
-		//fmt.Printf("!!!why1")
-		m, _ := h.Write(signbytes[n:])
-		n += m
+// regenerate moves the attributes of old to a new session, without writing
+// the cookie.
+func (manager *SessionMgrUsingCookie) regenerate(r *http.Request, sid string, old Session) (Session, error) {
+	newsid, err := manager.NewSessionIdErr(r)
+	if err != nil {
+		return nil, err
 	}
+	encoded, err := old.Attributes().Encode()
+	if err != nil {
+		return nil, err
+	}
+	attrs := manager.provider.NewSessionAttributes(newsid)
+	if err := attrs.Decode(encoded); err != nil {
+		return nil, err
+	}
+	attrs.SetTimeAccessed(time.Now())
 
-	n, _ = h.Write(randbb)
-	for n < randlen {
-		//fmt.Printf("!!!why2")
-		m, _ := h.Write(randbb[n:])
-		n += m
+	sxn := manager.newSession(newsid, attrs)
+	if err := manager.provider.AddNewSession(sxn); err != nil {
+		return nil, err
 	}
+	manager.provider.RemoveSession(sid)
+	return sxn, nil
+}
 
-	return hex.EncodeToString(h.Sum(nil))
+func (manager *SessionMgrUsingCookie) newSession(sid string, attrs SessionAttributes) Session {
+	if manager.NewSession == nil {
+		return newBasicSession(sid, attrs)
+	}
+	return manager.NewSession(sid, attrs)
 }
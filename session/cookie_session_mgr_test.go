@@ -0,0 +1,69 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUnsignedUntil(t *testing.T) {
+	mgr, err := NewSessionMgrUsingCookie(NewMemSessionProvider(3600, ""), "sid", 0, "localhost", true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr.HashKey = "0123456789abcdef0123456789abcdef"
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "sid", Value: "0123456789abcdef"})
+
+	mgr.UnsignedUntil = time.Now().Add(time.Minute)
+	if sid, err := mgr.GetSessionCookie(req); err != nil || sid != "0123456789abcdef" {
+		t.Errorf("before UnsignedUntil: got %q, %v, want the unsigned sid", sid, err)
+	}
+
+	mgr.UnsignedUntil = time.Now().Add(-time.Minute)
+	if sid, err := mgr.GetSessionCookie(req); err != ErrInvalidCookieValue {
+		t.Errorf("after UnsignedUntil: got %q, %v, want ErrInvalidCookieValue", sid, err)
+	}
+
+	// Signed cookies are accepted either way.
+	rec := httptest.NewRecorder()
+	mgr.SetSessionCookie(rec, "0123456789abcdef")
+	signed := httptest.NewRequest("GET", "/", nil)
+	for _, c := range rec.Result().Cookies() {
+		signed.AddCookie(c)
+	}
+	if sid, err := mgr.GetSessionCookie(signed); err != nil || sid != "0123456789abcdef" {
+		t.Errorf("signed cookie: got %q, %v, want the sid", sid, err)
+	}
+}
+
+func TestHashKeyRotation(t *testing.T) {
+	mgr, err := NewSessionMgrUsingCookie(NewMemSessionProvider(3600, ""), "sid", 0, "localhost", true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKey := "0123456789abcdef0123456789abcdef"
+	mgr.HashKey = oldKey
+	rec := httptest.NewRecorder()
+	mgr.SetSessionCookie(rec, "0123456789abcdef")
+	req := httptest.NewRequest("GET", "/", nil)
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+
+	mgr.HashKey = "fedcba9876543210fedcba9876543210"
+	if _, err := mgr.GetSessionCookie(req); err != ErrInvalidCookieValue {
+		t.Errorf("cookie signed with a dropped key: got %v, want ErrInvalidCookieValue", err)
+	}
+	mgr.OldHashKeys = []string{oldKey}
+	if sid, err := mgr.GetSessionCookie(req); err != nil || sid != "0123456789abcdef" {
+		t.Errorf("cookie signed with an old key: got %q, %v, want the sid", sid, err)
+	}
+
+	mgr.HashKey = "too short"
+	if _, err := mgr.GetSessionCookie(req); err == nil || err == ErrInvalidCookieValue {
+		t.Errorf("short HashKey: got %v, want a key length error", err)
+	}
+}
@@ -0,0 +1,369 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"time"
+)
+
+// DefaultMaxCookieSize is the default CookieSessionProvider.MaxCookieSize,
+// browsers keep cookies up to about 4096 bytes, name and attributes included.
+const DefaultMaxCookieSize = 3800
+
+var (
+	ErrCookieTooLarge     = errors.New("session: encoded session exceeds the cookie size limit")
+	ErrInvalidCookieValue = errors.New("session: invalid or tampered cookie value")
+)
+
+// CookieSessionProvider keeps the sessions in the client cookie rather than in
+// server memory, so stateless replicas share them without sticky routing.
+//
+// The cookie value is the encoded SessionAttributes, HMAC-signed and, if
+// enabled, AES-GCM encrypted. The "sid" given to GetSession and HasSession is
+// the cookie value itself; SessionMgrUsingCookie.SaveSession writes it after
+// the attributes are changed:
+//
+//     provider, err := session.NewCookieSessionProvider(3600, "sha256",
+//         []string{newKey, oldKey}, true, nil)
+//     mgr, err := session.NewSessionMgrUsingCookie(provider, "s", 3600, "example.com", true, true)
+//     ...
+//     sxn.Attributes().Set("uid", uid)
+//     err = mgr.SaveSession(w, sxn)
+//
+// The first key signs and encrypts, all of them verify, so keys can be
+// rotated by adding a new key first and dropping the old one once the cookies
+// it signed have expired.
+type CookieSessionProvider struct {
+	timeoutseconds int64
+	signer         *cookieSigner
+	// One AEAD per key, nil if encryption is disabled.
+	aeads      []cipher.AEAD
+	newSession func(sid string, attrs SessionAttributes) Session
+	codec      codecValue
+	// Size limit of the cookie value, DefaultMaxCookieSize if 0.
+	MaxCookieSize int
+}
+
+// NewCookieSessionProvider returns a provider signing with the hash function
+// hashFuncName (md5, sha1, sha256 or sha512) keyed by keys, newest first.
+// Keys must be at least 16 bytes long. newSession makes the Session of
+// decoded attributes, a minimal Session if nil.
+func NewCookieSessionProvider(timeoutseconds int64, hashFuncName string, keys []string, encrypt bool, newSession func(sid string, attrs SessionAttributes) Session) (*CookieSessionProvider, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("session: no cookie key")
+	}
+	for _, key := range keys {
+		if len(key) < 16 {
+			return nil, errors.New("session: cookie keys must be at least 16 bytes")
+		}
+	}
+	signer, err := newCookieSigner(hashFuncName, keys)
+	if err != nil {
+		return nil, err
+	}
+	if newSession == nil {
+		newSession = newBasicSession
+	}
+	pder := &CookieSessionProvider{
+		timeoutseconds: timeoutseconds,
+		signer:         signer,
+		newSession:     newSession,
+	}
+	if encrypt {
+		for _, key := range keys {
+			block, err := aes.NewCipher(deriveKey(key, "encrypt"))
+			if err != nil {
+				return nil, err
+			}
+			aead, err := cipher.NewGCM(block)
+			if err != nil {
+				return nil, err
+			}
+			pder.aeads = append(pder.aeads, aead)
+		}
+	}
+	return pder, nil
+}
+
+// SetCodec sets the codec of the sessions sealed from now on, cookies
+// sealed with other codecs are still read.
+func (pder *CookieSessionProvider) SetCodec(c Codec) {
+	pder.codec.Store(c)
+}
+
+func (pder *CookieSessionProvider) SessionInit() error {
+	return nil
+}
+
+func (pder *CookieSessionProvider) TimeoutSeconds() int64 {
+	return pder.timeoutseconds
+}
+
+//not change the last-access-time
+func (pder *CookieSessionProvider) HasSession(value string) (bool, error) {
+	_, accessed, _, err := pder.open(value)
+	if err != nil {
+		return false, nil
+	}
+	return accessed.Unix()+pder.timeoutseconds >= time.Now().Unix(), nil
+}
+
+// GetSession decodes the cookie value, it returns nil and no error if the
+// session has expired, and an error if the value is not valid.
+func (pder *CookieSessionProvider) GetSession(value string) (Session, error) {
+	sid, accessed, encoded, err := pder.open(value)
+	if err != nil {
+		return nil, err
+	}
+	if accessed.Unix()+pder.timeoutseconds < time.Now().Unix() {
+		return nil, nil
+	}
+	attrs := NewMemSessionAttributes(sid, nil)
+	attrs.SetCodec(pder.codec.Load())
+	if len(encoded) > 0 {
+		if err := attrs.Decode(encoded); err != nil {
+			return nil, err
+		}
+	}
+	attrs.SetTimeAccessed(time.Now())
+	return pder.newSession(sid, attrs), nil
+}
+
+// AddNewSession only checks the session fits in a cookie, it is stored by
+// SessionMgrUsingCookie.SaveSession.
+func (pder *CookieSessionProvider) AddNewSession(sw Session) error {
+	if sw.SessionID() == "" {
+		return errors.New("can not create session with empty sid")
+	}
+	_, err := pder.Seal(sw)
+	return err
+}
+
+// RemoveSession does nothing, the session goes with its cookie, see
+// SessionMgrUsingCookie.DeleteSessionCookie.
+func (pder *CookieSessionProvider) RemoveSession(sid string) error {
+	return nil
+}
+
+func (pder *CookieSessionProvider) NewSessionAttributes(sid string) SessionAttributes {
+	attrs := NewMemSessionAttributes(sid, nil)
+	attrs.SetCodec(pder.codec.Load())
+	return attrs
+}
+
+// RemoveExpired does nothing, expired cookies are rejected by GetSession.
+func (pder *CookieSessionProvider) RemoveExpired() {
+}
+
+// PersistSessions does nothing, the sessions are in the cookies.
+func (pder *CookieSessionProvider) PersistSessions() {
+}
+
+// Seal encodes the session into a cookie value. It returns ErrCookieTooLarge
+// if the value exceeds MaxCookieSize.
+func (pder *CookieSessionProvider) Seal(sw Session) (string, error) {
+	attrs := sw.Attributes()
+	if attrs == nil {
+		return "", errors.New("session: no attributes to seal")
+	}
+	sid := sw.SessionID()
+	if len(sid) > 255 {
+		return "", errors.New("session: sid too long for a cookie session")
+	}
+	encoded, err := attrs.Encode()
+	if err != nil {
+		return "", err
+	}
+
+	// accessed time, sid length, sid, attributes
+	body := make([]byte, 9, 9+len(sid)+len(encoded))
+	binary.BigEndian.PutUint64(body, uint64(attrs.TimeAccessed().Unix()))
+	body[8] = byte(len(sid))
+	body = append(body, sid...)
+	body = append(body, encoded...)
+
+	var data []byte
+	if pder.aeads == nil {
+		data = append([]byte{cookieFormatPlain}, body...)
+	} else {
+		aead := pder.aeads[0]
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return "", err
+		}
+		data = append([]byte{cookieFormatSealed}, nonce...)
+		data = aead.Seal(data, nonce, body, []byte{cookieFormatSealed})
+	}
+
+	value := base64.RawURLEncoding.EncodeToString(pder.signer.sign(data))
+	maxSize := pder.MaxCookieSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxCookieSize
+	}
+	if len(value) > maxSize {
+		return "", ErrCookieTooLarge
+	}
+	return value, nil
+}
+
+const (
+	cookieFormatPlain  = byte(1)
+	cookieFormatSealed = byte(2)
+)
+
+// open verifies and decrypts a cookie value.
+func (pder *CookieSessionProvider) open(value string) (sid string, accessed time.Time, encoded []byte, err error) {
+	maxSize := pder.MaxCookieSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxCookieSize
+	}
+	if value == "" || len(value) > maxSize {
+		return "", accessed, nil, ErrInvalidCookieValue
+	}
+	signed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return "", accessed, nil, ErrInvalidCookieValue
+	}
+	data, keyIndex, ok := pder.signer.verify(signed)
+	if !ok || len(data) == 0 {
+		return "", accessed, nil, ErrInvalidCookieValue
+	}
+
+	var body []byte
+	switch data[0] {
+	case cookieFormatPlain:
+		if pder.aeads != nil {
+			// Encryption is required once enabled.
+			return "", accessed, nil, ErrInvalidCookieValue
+		}
+		body = data[1:]
+	case cookieFormatSealed:
+		if pder.aeads == nil {
+			return "", accessed, nil, ErrInvalidCookieValue
+		}
+		aead := pder.aeads[keyIndex]
+		if len(data) < 1+aead.NonceSize() {
+			return "", accessed, nil, ErrInvalidCookieValue
+		}
+		nonce := data[1 : 1+aead.NonceSize()]
+		body, err = aead.Open(nil, nonce, data[1+aead.NonceSize():], []byte{cookieFormatSealed})
+		if err != nil {
+			return "", accessed, nil, ErrInvalidCookieValue
+		}
+	default:
+		return "", accessed, nil, ErrInvalidCookieValue
+	}
+
+	if len(body) < 9 || len(body) < 9+int(body[8]) {
+		return "", accessed, nil, ErrInvalidCookieValue
+	}
+	accessed = time.Unix(int64(binary.BigEndian.Uint64(body)), 0)
+	n := 9 + int(body[8])
+	return string(body[9:n]), accessed, body[n:], nil
+}
+
+// ----------------------------------------------------------------------------
+// cookieSigner
+// ----------------------------------------------------------------------------
+
+// cookieSigner appends and verifies a HMAC, the first key signs and all of
+// them verify.
+type cookieSigner struct {
+	hash func() hash.Hash
+	keys [][]byte
+}
+
+func newCookieSigner(hashFuncName string, keys []string) (*cookieSigner, error) {
+	var h func() hash.Hash
+	switch strings.ToLower(hashFuncName) {
+	case "md5":
+		h = md5.New
+	case "sha1":
+		h = sha1.New
+	case "", "sha256":
+		h = sha256.New
+	case "sha512":
+		h = sha512.New
+	default:
+		return nil, fmt.Errorf("session: unsupported hash function %q", hashFuncName)
+	}
+	signer := &cookieSigner{hash: h}
+	for _, key := range keys {
+		signer.keys = append(signer.keys, deriveKey(key, "sign"))
+	}
+	return signer, nil
+}
+
+func (s *cookieSigner) mac(key, data []byte) []byte {
+	m := hmac.New(s.hash, key)
+	m.Write(data)
+	return m.Sum(nil)
+}
+
+// sign returns data followed by its HMAC.
+func (s *cookieSigner) sign(data []byte) []byte {
+	return append(data, s.mac(s.keys[0], data)...)
+}
+
+// verify returns the data without its HMAC and the index of the key that
+// signed it.
+func (s *cookieSigner) verify(signed []byte) ([]byte, int, bool) {
+	size := s.hash().Size()
+	if len(signed) < size {
+		return nil, 0, false
+	}
+	data, sum := signed[:len(signed)-size], signed[len(signed)-size:]
+	for i, key := range s.keys {
+		if subtle.ConstantTimeCompare(s.mac(key, data), sum) == 1 {
+			return data, i, true
+		}
+	}
+	return nil, 0, false
+}
+
+// deriveKey derives independent keys for each purpose from a configured key.
+func deriveKey(key, purpose string) []byte {
+	m := hmac.New(sha256.New, []byte(key))
+	m.Write([]byte("goweb session " + purpose))
+	return m.Sum(nil)
+}
+
+// ----------------------------------------------------------------------------
+// basicSession
+// ----------------------------------------------------------------------------
+
+// basicSession is the Session made by providers given no constructor.
+type basicSession struct {
+	sid   string
+	attrs SessionAttributes
+}
+
+func newBasicSession(sid string, attrs SessionAttributes) Session {
+	return &basicSession{sid: sid, attrs: attrs}
+}
+
+func (s *basicSession) Attributes() SessionAttributes {
+	return s.attrs
+}
+
+func (s *basicSession) SetAttributes(attrs SessionAttributes) {
+	s.attrs = attrs
+}
+
+func (s *basicSession) SessionID() string {
+	return s.sid
+}
@@ -0,0 +1,29 @@
+package session
+
+import (
+	"net/http"
+
+	"github.com/fwis/goweb/sweb/logs"
+)
+
+var logVar logs.Var
+
+func logger() logs.Logger { return logVar.Get() }
+
+func init() {
+	// Adds the session of the request, once loaded, to the logs of a request.
+	logs.RegisterRequestFields(func(r *http.Request) []interface{} {
+		if rs := FromRequest(r); rs != nil {
+			if id := rs.logID(); id != "" {
+				return []interface{}{"sid", id}
+			}
+		}
+		return nil
+	})
+}
+
+// SetLogger sets the logger of the session managers and providers,
+// logs.Discard silences them.
+func SetLogger(l logs.Logger) {
+	logVar.Set(l)
+}
@@ -11,6 +11,7 @@ type MemSessionAttributes struct {
 	lock         sync.RWMutex
 	fp           *SessionFilePersistence
 	sid          string
+	codec        codecValue //SetCodec 设置; 为 nil 时用 fp 当前的 codec, 再为 nil 时用 DefaultCodec
 }
 
 func NewMemSessionAttributes(sid string, fp *SessionFilePersistence) *MemSessionAttributes {
@@ -22,6 +23,12 @@ func NewMemSessionAttributes(sid string, fp *SessionFilePersistence) *MemSession
 	return sxn
 }
 
+// SetCodec sets the codec of Encode, nil for the current one of the
+// persistence; Decode reads any registered codec.
+func (st *MemSessionAttributes) SetCodec(c Codec) {
+	st.codec.Store(c)
+}
+
 func (st *MemSessionAttributes) SessionID() string {
 	return st.sid
 }
@@ -83,11 +90,15 @@ func (st *MemSessionAttributes) Release() {
 }
 
 func (st *MemSessionAttributes) Encode() ([]byte, error) {
-	return EncodeGob(st.kv)
+	c := st.codec.Load()
+	if c == nil {
+		c = st.fp.Codec()
+	}
+	return EncodeAttributes(c, st.kv)
 }
 
 func (st *MemSessionAttributes) Decode(encoded []byte) error {
-	kv, err := DecodeGob(encoded)
+	kv, err := DecodeAttributes(encoded)
 	if err != nil {
 		return err
 	}
@@ -3,10 +3,10 @@ package session
 import (
 	"container/list"
 	"errors"
-	"fmt"
 	"io/ioutil"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,6 +16,7 @@ type MemSessionProvider struct {
 	list           *list.List               //用来做gc
 	timeoutseconds int64
 	fp             *SessionFilePersistence
+	evictions      int64 //RemoveExpired 删除的 session 数, atomic
 }
 
 func NewMemSessionProvider(timeoutseconds int64, savepath string) *MemSessionProvider {
@@ -27,6 +28,26 @@ func NewMemSessionProvider(timeoutseconds int64, savepath string) *MemSessionPro
 	return provider
 }
 
+// Len returns the number of sessions in memory.
+func (pder *MemSessionProvider) Len() int {
+	pder.lock.RLock()
+	defer pder.lock.RUnlock()
+	return len(pder.sessions)
+}
+
+// Evictions returns the number of expired sessions removed so far.
+func (pder *MemSessionProvider) Evictions() int64 {
+	return atomic.LoadInt64(&pder.evictions)
+}
+
+// SetCodec sets the codec of the sessions saved from now on, the ones already
+// in memory included.
+func (pder *MemSessionProvider) SetCodec(c Codec) {
+	if pder.fp != nil {
+		pder.fp.SetCodec(c)
+	}
+}
+
 func (pder *MemSessionProvider) TimeoutSeconds() int64 {
 	return pder.timeoutseconds
 }
@@ -51,7 +72,7 @@ func (pder *MemSessionProvider) LoadSessions(f func(sid string, attr SessionAttr
 
 		sid, attributes, err := LoadSessionAttributesFromFile(pder.fp, sidFilePath)
 		if err != nil {
-			fmt.Printf("ignore! fail to load session from session file=%v\n", sidFilePath)
+			logger().Warnf("ignore! fail to load session from session file=%v, err=%v", sidFilePath, err)
 			//return err
 			continue
 		}
@@ -170,6 +191,7 @@ func (pder *MemSessionProvider) RemoveExpired() {
 			if pder.fp != nil {
 				pder.fp.Remove(sxn.SessionID())
 			}
+			atomic.AddInt64(&pder.evictions, 1)
 			pder.lock.Unlock()
 			pder.lock.RLock()
 		} else {
@@ -216,7 +238,7 @@ func (pder *MemSessionProvider) PersistSessions() {
 		if sxn != nil {
 			err := pder.fp.Save(sxn.Attributes())
 			if err != nil {
-				fmt.Printf("ignore! fail to save session, sid=%v, err=%v\n", sxn.SessionID(), err)
+				logger().With("sid", sxn.SessionID()).Errorf("ignore! fail to save session, err=%v", err)
 			}
 		}
 	}
@@ -0,0 +1,31 @@
+package session
+
+import (
+	"testing"
+)
+
+// TestMemSetCodecExistingSessions checks SetCodec applies to the sessions
+// already in memory.
+func TestMemSetCodecExistingSessions(t *testing.T) {
+	pder := NewMemSessionProvider(3600, t.TempDir())
+	attrs := pder.NewSessionAttributes("s1")
+	if err := pder.AddNewSession(newBasicSession("s1", attrs)); err != nil {
+		t.Fatal(err)
+	}
+	if err := attrs.Set("uid", "42"); err != nil {
+		t.Fatal(err)
+	}
+
+	pder.SetCodec(JSONCodec)
+	encoded, err := attrs.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoded[0] != JSONCodecID {
+		t.Errorf("header 0x%02x after SetCodec(JSONCodec), want 0x%02x", encoded[0], JSONCodecID)
+	}
+	kv, err := DecodeAttributes(encoded)
+	if err != nil || kv["uid"] != "42" {
+		t.Errorf("decoded %v, %v", kv, err)
+	}
+}
@@ -0,0 +1,327 @@
+package session
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fwis/goweb/sweb/route"
+)
+
+type contextKey int
+
+const requestSessionKey contextKey = 0
+
+// Middleware returns the route.Middleware giving each request a
+// RequestSession, see FromRequest:
+//
+//     r.Use(mgr.Middleware())
+//     ...
+//     func login(w http.ResponseWriter, r *http.Request, v url.Values) {
+//         s := session.FromRequest(r)
+//         s.Regenerate()
+//         s.Set("uid", uid)
+//     }
+//
+// The session is loaded on first use, and created by the first Set, so no
+// cookie is sent to clients which never get a session. The cookie is written
+// with the response headers, when the session was created, changed, or on
+// every request if the manager is Sliding.
+func (manager *SessionMgrUsingCookie) Middleware() route.Middleware {
+	return func(next route.VHandler) route.VHandler {
+		return route.VHandlerFunc(func(w http.ResponseWriter, r *http.Request, v url.Values) {
+			rs := &RequestSession{mgr: manager, w: w}
+			r = r.WithContext(context.WithValue(r.Context(), requestSessionKey, rs))
+			rs.r = r
+			next.VServeHTTP(&sessionWriter{ResponseWriter: w, rs: rs}, r, v)
+			rs.commit()
+		})
+	}
+}
+
+// FromRequest returns the session of a request served through
+// SessionMgrUsingCookie.Middleware, nil otherwise.
+func FromRequest(r *http.Request) *RequestSession {
+	rs, _ := r.Context().Value(requestSessionKey).(*RequestSession)
+	return rs
+}
+
+// RequestSession is the session of a request, loaded or created on demand.
+// Changes made through it are saved with the response; after changing the
+// Session attributes directly, call Save.
+type RequestSession struct {
+	mgr *SessionMgrUsingCookie
+	w   http.ResponseWriter
+	r   *http.Request
+
+	lock sync.Mutex
+	sxn  Session
+	// Cookie value the session was loaded from.
+	sid       string
+	loaded    bool
+	dirty     bool
+	destroyed bool
+	committed bool
+	// Session ID for the logs, read without the lock, see logID.
+	id atomic.Value
+}
+
+// set sets the session and the cookie value it was loaded from.
+func (rs *RequestSession) set(sxn Session, sid string) {
+	rs.sxn, rs.sid = sxn, sid
+	id := ""
+	if sxn != nil {
+		id = sxn.SessionID()
+	}
+	rs.id.Store(id)
+}
+
+// logID returns the ID of the session, "" if it's not loaded yet, hashed:
+// the logs must not give out the ID, the session can be taken with it.
+func (rs *RequestSession) logID() string {
+	id, _ := rs.id.Load().(string)
+	if id == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:8])
+}
+
+// load reads the session of the request cookie once, invalid or expired
+// cookies count as no session.
+func (rs *RequestSession) load() {
+	if rs.loaded {
+		return
+	}
+	rs.loaded = true
+	sid, unsigned, err := rs.mgr.sessionCookie(rs.r)
+	if err != nil || sid == "" {
+		return
+	}
+	sxn, err := rs.mgr.GetSession(sid)
+	if err != nil {
+		logger().Debugf("ignore! invalid session cookie, err=%v", err)
+		return
+	}
+	if sxn != nil && sxn.Attributes() != nil {
+		rs.set(sxn, sid)
+		// Rewrite the cookie signed, see UnsignedUntil.
+		rs.dirty = rs.dirty || unsigned
+	}
+}
+
+// create makes a new session, saved with the response.
+func (rs *RequestSession) create() error {
+	sid, err := rs.mgr.NewSessionIdErr(rs.r)
+	if err != nil {
+		return err
+	}
+	sxn := rs.mgr.newSession(sid, rs.mgr.NewSessionAttributes(sid))
+	if err := rs.mgr.AddNewSession(sxn); err != nil {
+		return err
+	}
+	rs.set(sxn, "")
+	rs.destroyed = false
+	rs.changed()
+	return nil
+}
+
+// changed marks the session to be saved with the response.
+func (rs *RequestSession) changed() {
+	rs.dirty = true
+	if rs.committed {
+		logger().Warnf("session changed after the response headers were written, the cookie is not updated")
+	}
+}
+
+// Session returns the session, created if the request has none.
+func (rs *RequestSession) Session() (Session, error) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.load()
+	if rs.sxn == nil {
+		if err := rs.create(); err != nil {
+			return nil, err
+		}
+	}
+	return rs.sxn, nil
+}
+
+// Exists reports whether the request has a session, without creating one.
+func (rs *RequestSession) Exists() bool {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.load()
+	return rs.sxn != nil
+}
+
+// ID returns the session ID, "" if there is no session.
+func (rs *RequestSession) ID() string {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.load()
+	if rs.sxn == nil {
+		return ""
+	}
+	return rs.sxn.SessionID()
+}
+
+// Get returns a session value, nil if there is no session.
+func (rs *RequestSession) Get(key string) interface{} {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.load()
+	if rs.sxn == nil {
+		return nil
+	}
+	return rs.sxn.Attributes().Get(key)
+}
+
+// Set sets a session value, creating the session if needed.
+func (rs *RequestSession) Set(key string, value interface{}) error {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.load()
+	if rs.sxn == nil {
+		if err := rs.create(); err != nil {
+			return err
+		}
+	}
+	if err := rs.sxn.Attributes().Set(key, value); err != nil {
+		return err
+	}
+	rs.changed()
+	return nil
+}
+
+// Delete deletes a session value, it doesn't create a session.
+func (rs *RequestSession) Delete(key string) error {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.load()
+	if rs.sxn == nil {
+		return nil
+	}
+	if err := rs.sxn.Attributes().Delete(key); err != nil {
+		return err
+	}
+	rs.changed()
+	return nil
+}
+
+// Save marks the session to be saved with the response, after its
+// attributes were changed directly.
+func (rs *RequestSession) Save() {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.load()
+	if rs.sxn != nil {
+		rs.changed()
+	}
+}
+
+// Regenerate moves the session to a new ID, creating it if needed, to
+// prevent session fixation on login.
+func (rs *RequestSession) Regenerate() error {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.load()
+	if rs.sxn == nil {
+		return rs.create()
+	}
+	sxn, err := rs.mgr.regenerate(rs.r, rs.sid, rs.sxn)
+	if err != nil {
+		return err
+	}
+	rs.set(sxn, "")
+	rs.changed()
+	return nil
+}
+
+// Destroy removes the session from the provider and deletes the cookie, on
+// logout. A later Set starts a new session.
+//
+// With a CookieSessionProvider nothing is kept on the server, so a copy of
+// the cookie stays valid until the session times out.
+func (rs *RequestSession) Destroy() error {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.load()
+	if rs.sxn != nil {
+		if err := rs.mgr.provider.RemoveSession(rs.sxn.SessionID()); err != nil {
+			return err
+		}
+		if rs.sid != "" && rs.sid != rs.sxn.SessionID() {
+			// The cookie holds more than the sid, like with a CookieSessionProvider.
+			rs.mgr.provider.RemoveSession(rs.sid)
+		}
+	}
+	rs.set(nil, "")
+	rs.destroyed = true
+	rs.changed()
+	return nil
+}
+
+// commit writes the cookie, once, before the response headers.
+func (rs *RequestSession) commit() {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	if rs.committed {
+		return
+	}
+	rs.committed = true
+	switch {
+	case rs.destroyed && rs.sxn == nil:
+		rs.mgr.DeleteSessionCookie(rs.w)
+	case rs.sxn != nil && (rs.dirty || rs.mgr.Sliding):
+		if err := rs.mgr.SaveSession(rs.w, rs.sxn); err != nil {
+			logger().Errorf("fail to save session cookie, err=%v", err)
+		}
+	}
+}
+
+// sessionWriter commits the session before the response headers are written.
+type sessionWriter struct {
+	http.ResponseWriter
+	rs *RequestSession
+}
+
+func (w *sessionWriter) WriteHeader(status int) {
+	w.rs.commit()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *sessionWriter) Write(b []byte) (int, error) {
+	w.rs.commit()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher.
+func (w *sessionWriter) Flush() {
+	w.rs.commit()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker.
+func (w *sessionWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("session: the ResponseWriter doesn't support Hijack")
+	}
+	w.rs.commit()
+	return h.Hijack()
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (w *sessionWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,369 @@
+package session
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+// A minimal MessagePack implementation for MsgpackCodec, see
+// https://github.com/msgpack/msgpack/blob/master/spec.md
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// msgpackMaxDepth bounds the nesting of decoded containers.
+const msgpackMaxDepth = 64
+
+type msgpackEncoder struct {
+	buf []byte
+}
+
+func (e *msgpackEncoder) byte1(b byte) {
+	e.buf = append(e.buf, b)
+}
+
+func (e *msgpackEncoder) uint(code byte, v uint64, size int) {
+	e.buf = append(e.buf, code)
+	e.bigEndian(v, size)
+}
+
+// bigEndian appends the size low bytes of v.
+func (e *msgpackEncoder) bigEndian(v uint64, size int) {
+	for i := size - 1; i >= 0; i-- {
+		e.buf = append(e.buf, byte(v>>(8*uint(i))))
+	}
+}
+
+// length writes the header of a str, bin, array or map, fix is the fixed
+// format code if any, codes the 8, 16 and 32 bits ones.
+func (e *msgpackEncoder) length(n int, fix byte, fixMax int, codes [3]byte) {
+	switch {
+	case fixMax > 0 && n <= fixMax:
+		e.byte1(fix | byte(n))
+	case codes[0] != 0 && n <= math.MaxUint8:
+		e.uint(codes[0], uint64(n), 1)
+	case n <= math.MaxUint16:
+		e.uint(codes[1], uint64(n), 2)
+	default:
+		e.uint(codes[2], uint64(n), 4)
+	}
+}
+
+func (e *msgpackEncoder) int(v int64) {
+	switch {
+	case v >= 0:
+		e.uint64(uint64(v))
+	case v >= -32:
+		e.byte1(byte(v))
+	case v >= math.MinInt8:
+		e.uint(0xd0, uint64(v), 1)
+	case v >= math.MinInt16:
+		e.uint(0xd1, uint64(v), 2)
+	case v >= math.MinInt32:
+		e.uint(0xd2, uint64(v), 4)
+	default:
+		e.uint(0xd3, uint64(v), 8)
+	}
+}
+
+func (e *msgpackEncoder) uint64(v uint64) {
+	switch {
+	case v <= 0x7f:
+		e.byte1(byte(v))
+	case v <= math.MaxUint8:
+		e.uint(0xcc, v, 1)
+	case v <= math.MaxUint16:
+		e.uint(0xcd, v, 2)
+	case v <= math.MaxUint32:
+		e.uint(0xce, v, 4)
+	default:
+		e.uint(0xcf, v, 8)
+	}
+}
+
+func (e *msgpackEncoder) string(s string) {
+	e.length(len(s), 0xa0, 31, [3]byte{0xd9, 0xda, 0xdb})
+	e.buf = append(e.buf, s...)
+}
+
+// time writes a timestamp 96 extension.
+func (e *msgpackEncoder) time(t time.Time) {
+	e.buf = append(e.buf, 0xc7, 12, 0xff)
+	e.bigEndian(uint64(t.Nanosecond()), 4)
+	e.bigEndian(uint64(t.Unix()), 8)
+}
+
+func (e *msgpackEncoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.byte1(0xc0)
+		return nil
+	}
+	if v.Type() == timeType {
+		e.time(v.Interface().(time.Time))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			e.byte1(0xc0)
+			return nil
+		}
+		return e.encode(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			e.byte1(0xc3)
+		} else {
+			e.byte1(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.uint64(v.Uint())
+	case reflect.Float32:
+		e.uint(0xca, uint64(math.Float32bits(float32(v.Float()))), 4)
+	case reflect.Float64:
+		e.uint(0xcb, math.Float64bits(v.Float()), 8)
+	case reflect.String:
+		e.string(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			var b []byte
+			if v.Kind() == reflect.Slice {
+				b = v.Bytes()
+			} else {
+				b = make([]byte, v.Len())
+				reflect.Copy(reflect.ValueOf(b), v)
+			}
+			e.length(len(b), 0, 0, [3]byte{0xc4, 0xc5, 0xc6})
+			e.buf = append(e.buf, b...)
+			return nil
+		}
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			e.byte1(0xc0)
+			return nil
+		}
+		e.length(v.Len(), 0x90, 15, [3]byte{0, 0xdc, 0xdd})
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("msgpack: unsupported map key type %s", v.Type().Key())
+		}
+		if v.IsNil() {
+			e.byte1(0xc0)
+			return nil
+		}
+		e.length(v.Len(), 0x80, 15, [3]byte{0, 0xde, 0xdf})
+		iter := v.MapRange()
+		for iter.Next() {
+			e.string(iter.Key().String())
+			if err := e.encode(iter.Value()); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+}
+
+var errMsgpackShort = errors.New("msgpack: unexpected end of data")
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.pos < n {
+		return nil, errMsgpackShort
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *msgpackDecoder) uint(size int) (uint64, error) {
+	b, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+func (d *msgpackDecoder) decode(depth int) (interface{}, error) {
+	if depth > msgpackMaxDepth {
+		return nil, errors.New("msgpack: nested too deeply")
+	}
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c >= 0xa0 && c <= 0xbf:
+		return d.str(int(c & 0x1f))
+	case c >= 0x90 && c <= 0x9f:
+		return d.array(int(c&0x0f), depth)
+	case c >= 0x80 && c <= 0x8f:
+		return d.mapping(int(c&0x0f), depth)
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (c - 0xcc))
+		if err != nil || u > math.MaxInt64 {
+			return u, err
+		}
+		return int64(u), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		u, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		shift := 64 - 8*uint(size)
+		return int64(u<<shift) >> shift, nil
+	case 0xca:
+		u, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := d.uint(8)
+		return math.Float64frombits(u), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(int(n))
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.next(int(n))
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(int(n), depth)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapping(int(n), depth)
+	case 0xd6, 0xd7, 0xc7:
+		return d.timestamp(c)
+	}
+	return nil, fmt.Errorf("msgpack: unsupported format 0x%02x", c)
+}
+
+func (d *msgpackDecoder) str(n int) (interface{}, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *msgpackDecoder) array(n int, depth int) (interface{}, error) {
+	if n > len(d.data)-d.pos {
+		return nil, errMsgpackShort
+	}
+	a := make([]interface{}, n)
+	for i := range a {
+		v, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		a[i] = v
+	}
+	return a, nil
+}
+
+func (d *msgpackDecoder) mapping(n int, depth int) (interface{}, error) {
+	if n > len(d.data)-d.pos {
+		return nil, errMsgpackShort
+	}
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("msgpack: map key is %T, not a string", k)
+		}
+		v, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+// timestamp decodes the timestamp extension, fixext 4 and 8, or ext 8 of 12
+// bytes.
+func (d *msgpackDecoder) timestamp(c byte) (interface{}, error) {
+	n := 4
+	switch c {
+	case 0xd7:
+		n = 8
+	case 0xc7:
+		size, err := d.uint(1)
+		if err != nil {
+			return nil, err
+		}
+		n = int(size)
+	}
+	b, err := d.next(1 + n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(b[0]) != -1 {
+		return nil, fmt.Errorf("msgpack: unsupported extension type %d", int8(b[0]))
+	}
+	b = b[1:]
+	switch n {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(b)), 0), nil
+	case 8:
+		u := binary.BigEndian.Uint64(b)
+		return time.Unix(int64(u&0x3ffffffff), int64(u>>34)), nil
+	case 12:
+		return time.Unix(int64(binary.BigEndian.Uint64(b[4:])), int64(binary.BigEndian.Uint32(b))), nil
+	}
+	return nil, fmt.Errorf("msgpack: invalid timestamp length %d", n)
+}
@@ -0,0 +1,182 @@
+package session
+
+import (
+	"errors"
+)
+
+// RedisSessionProvider stores the sessions in a Redis compatible server, so
+// several instances of an application share them.
+//
+// Each session is a key holding its encoded attributes, with a TTL of
+// TimeoutSeconds refreshed by GetSession, so the server expires the sessions
+// and RemoveExpired does nothing. The attributes are written through on each
+// Set, Delete and Clear; concurrent changes of a session from two instances
+// are last write wins, and changes to a session removed meanwhile fail with
+// ErrNoSession. GetSession needs GETEX, from Redis 6.2.
+type RedisSessionProvider struct {
+	client         *RESPClient
+	prefix         string
+	timeoutseconds int64
+	newSession     func(sid string, attrs SessionAttributes) Session
+	codec          codecValue
+}
+
+// NewRedisSessionProvider returns a provider storing the sessions under the
+// keys prefix+sid. newSession makes the Session of loaded attributes, a
+// minimal Session if nil.
+func NewRedisSessionProvider(client *RESPClient, prefix string, timeoutseconds int64, newSession func(sid string, attrs SessionAttributes) Session) *RedisSessionProvider {
+	if newSession == nil {
+		newSession = newBasicSession
+	}
+	return &RedisSessionProvider{
+		client:         client,
+		prefix:         prefix,
+		timeoutseconds: timeoutseconds,
+		newSession:     newSession,
+	}
+}
+
+// SetCodec sets the codec of the sessions saved from now on.
+func (pder *RedisSessionProvider) SetCodec(c Codec) {
+	pder.codec.Store(c)
+}
+
+// SessionInit checks the server is reachable.
+func (pder *RedisSessionProvider) SessionInit() error {
+	_, err := pder.client.Do("PING")
+	return err
+}
+
+func (pder *RedisSessionProvider) TimeoutSeconds() int64 {
+	return pder.timeoutseconds
+}
+
+func (pder *RedisSessionProvider) key(sid string) string {
+	return pder.prefix + sid
+}
+
+//not change the last-access-time
+func (pder *RedisSessionProvider) HasSession(sid string) (bool, error) {
+	n, err := pder.client.Do("EXISTS", pder.key(sid))
+	if err != nil {
+		return false, err
+	}
+	return n == int64(1), nil
+}
+
+//will update the last-access-time
+func (pder *RedisSessionProvider) GetSession(sid string) (Session, error) {
+	if sid == "" {
+		return nil, nil
+	}
+	// GETEX reads the session and resets its TTL at once, a session can't
+	// expire or be removed between the two.
+	v, err := pder.client.Do("GETEX", pder.key(sid), "EX", pder.timeoutseconds)
+	if err != nil {
+		return nil, err
+	}
+	encoded, ok := v.([]byte)
+	if !ok {
+		return nil, nil
+	}
+	attrs := pder.newAttributes(sid)
+	if err := attrs.MemSessionAttributes.Decode(encoded); err != nil {
+		return nil, err
+	}
+	return pder.newSession(sid, attrs), nil
+}
+
+// AddNewSession stores the session, it fails if the sid exists.
+func (pder *RedisSessionProvider) AddNewSession(sw Session) error {
+	sid := sw.SessionID()
+	if sid == "" {
+		return errors.New("can not create session with empty sid")
+	}
+	encoded := []byte{}
+	if attrs := sw.Attributes(); attrs != nil {
+		var err error
+		if encoded, err = attrs.Encode(); err != nil {
+			return err
+		}
+	}
+	v, err := pder.client.Do("SET", pder.key(sid), encoded, "EX", pder.timeoutseconds, "NX")
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return errors.New("session with sid=" + sid + " exist")
+	}
+	return nil
+}
+
+func (pder *RedisSessionProvider) RemoveSession(sid string) error {
+	if sid == "" {
+		return nil
+	}
+	_, err := pder.client.Do("DEL", pder.key(sid))
+	return err
+}
+
+func (pder *RedisSessionProvider) NewSessionAttributes(sid string) SessionAttributes {
+	return pder.newAttributes(sid)
+}
+
+func (pder *RedisSessionProvider) newAttributes(sid string) *redisSessionAttributes {
+	attrs := NewMemSessionAttributes(sid, nil)
+	attrs.SetCodec(pder.codec.Load())
+	return &redisSessionAttributes{MemSessionAttributes: attrs, pder: pder}
+}
+
+// RemoveExpired does nothing, the keys expire with their TTL.
+func (pder *RedisSessionProvider) RemoveExpired() {
+}
+
+// PersistSessions does nothing, the attributes are written through.
+func (pder *RedisSessionProvider) PersistSessions() {
+}
+
+// save writes the attributes and resets the session TTL. It returns
+// ErrNoSession if the session was removed or expired meanwhile, maybe by
+// another instance, rather than bringing it back.
+func (pder *RedisSessionProvider) save(attrs SessionAttributes) error {
+	encoded, err := attrs.Encode()
+	if err != nil {
+		return err
+	}
+	v, err := pder.client.Do("SET", pder.key(attrs.SessionID()), encoded, "EX", pder.timeoutseconds, "XX")
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return ErrNoSession
+	}
+	return nil
+}
+
+// redisSessionAttributes are MemSessionAttributes written through to the
+// server on each change.
+type redisSessionAttributes struct {
+	*MemSessionAttributes
+	pder *RedisSessionProvider
+}
+
+func (st *redisSessionAttributes) Set(key string, value interface{}) error {
+	if err := st.MemSessionAttributes.Set(key, value); err != nil {
+		return err
+	}
+	return st.pder.save(st)
+}
+
+func (st *redisSessionAttributes) Delete(key string) error {
+	if err := st.MemSessionAttributes.Delete(key); err != nil {
+		return err
+	}
+	return st.pder.save(st)
+}
+
+func (st *redisSessionAttributes) Clear() error {
+	if err := st.MemSessionAttributes.Clear(); err != nil {
+		return err
+	}
+	return st.pder.save(st)
+}
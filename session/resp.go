@@ -0,0 +1,243 @@
+package session
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RESPError is an error reply of a RESP (Redis protocol) server.
+type RESPError string
+
+func (e RESPError) Error() string {
+	return string(e)
+}
+
+var errRESPProtocol = errors.New("session: RESP protocol error")
+
+// writeRESPCommand writes args as an array of bulk strings.
+func writeRESPCommand(w *bufio.Writer, args []interface{}) error {
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		var b []byte
+		switch a := arg.(type) {
+		case string:
+			b = []byte(a)
+		case []byte:
+			b = a
+		case int:
+			b = strconv.AppendInt(nil, int64(a), 10)
+		case int64:
+			b = strconv.AppendInt(nil, a, 10)
+		default:
+			return fmt.Errorf("session: unsupported RESP argument type %T", arg)
+		}
+		fmt.Fprintf(w, "$%d\r\n", len(b))
+		w.Write(b)
+		w.WriteString("\r\n")
+	}
+	return w.Flush()
+}
+
+// readRESPLine reads a line without its CRLF.
+func readRESPLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		if err == bufio.ErrBufferFull {
+			return nil, errRESPProtocol
+		}
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errRESPProtocol
+	}
+	return line[:len(line)-2], nil
+}
+
+// readRESPValue reads a reply: string for simple strings, RESPError,
+// int64, []byte for bulk strings, []interface{} for arrays, or nil.
+func readRESPValue(r *bufio.Reader) (interface{}, error) {
+	line, err := readRESPLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errRESPProtocol
+	}
+	switch line[0] {
+	case '+':
+		return string(line[1:]), nil
+	case '-':
+		return RESPError(line[1:]), nil
+	case ':':
+		n, err := strconv.ParseInt(string(line[1:]), 10, 64)
+		if err != nil {
+			return nil, errRESPProtocol
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil || n < -1 || n > 512*1024*1024 {
+			return nil, errRESPProtocol
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		if b[n] != '\r' || b[n+1] != '\n' {
+			return nil, errRESPProtocol
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil || n < -1 || n > 1024*1024 {
+			return nil, errRESPProtocol
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		a := make([]interface{}, n)
+		for i := range a {
+			if a[i], err = readRESPValue(r); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	}
+	return nil, errRESPProtocol
+}
+
+// ----------------------------------------------------------------------------
+// RESPClient
+// ----------------------------------------------------------------------------
+
+// RESPClient is a minimal client of a Redis compatible server, with a pool
+// of connections. It's safe for concurrent use.
+type RESPClient struct {
+	addr string
+	// AUTH password, none if "".
+	Password string
+	// Database selected on connection.
+	DB          int
+	DialTimeout time.Duration
+	// Deadline of each command, none if 0.
+	IOTimeout time.Duration
+	// Idle connections kept, 2 if 0.
+	MaxIdle int
+
+	lock   sync.Mutex
+	idle   []*respConn
+	closed bool
+}
+
+type respConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+func NewRESPClient(addr string) *RESPClient {
+	return &RESPClient{addr: addr, DialTimeout: 5 * time.Second, IOTimeout: 5 * time.Second}
+}
+
+func (c *RESPClient) get() (*respConn, error) {
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return nil, errors.New("session: RESP client closed")
+	}
+	if n := len(c.idle); n > 0 {
+		rc := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.lock.Unlock()
+		return rc, nil
+	}
+	c.lock.Unlock()
+
+	conn, err := net.DialTimeout("tcp", c.addr, c.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	rc := &respConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	if c.Password != "" {
+		if _, err := c.do(rc, []interface{}{"AUTH", c.Password}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if c.DB != 0 {
+		if _, err := c.do(rc, []interface{}{"SELECT", c.DB}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+func (c *RESPClient) put(rc *respConn) {
+	maxIdle := c.MaxIdle
+	if maxIdle <= 0 {
+		maxIdle = 2
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed || len(c.idle) >= maxIdle {
+		rc.conn.Close()
+		return
+	}
+	c.idle = append(c.idle, rc)
+}
+
+func (c *RESPClient) do(rc *respConn, args []interface{}) (interface{}, error) {
+	if c.IOTimeout > 0 {
+		rc.conn.SetDeadline(time.Now().Add(c.IOTimeout))
+	}
+	if err := writeRESPCommand(rc.w, args); err != nil {
+		return nil, err
+	}
+	v, err := readRESPValue(rc.r)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := v.(RESPError); ok {
+		return nil, e
+	}
+	return v, nil
+}
+
+// Do sends a command and returns its reply, see readRESPValue. Error replies
+// are returned as RESPError. Arguments are strings, []byte or integers.
+func (c *RESPClient) Do(args ...interface{}) (interface{}, error) {
+	rc, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	v, err := c.do(rc, args)
+	if _, ok := err.(RESPError); err != nil && !ok {
+		// The connection state is unknown.
+		rc.conn.Close()
+		return nil, err
+	}
+	c.put(rc)
+	return v, err
+}
+
+// Close closes the idle connections, the client can't be used afterwards.
+func (c *RESPClient) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.closed = true
+	for _, rc := range c.idle {
+		rc.conn.Close()
+	}
+	c.idle = nil
+	return nil
+}
@@ -0,0 +1,346 @@
+package session
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RESPServer is a small in-process server speaking the Redis protocol, with
+// the string commands used by RedisSessionProvider: PING, ECHO, AUTH,
+// SELECT, GET, GETEX (EX, PX, PERSIST), SET (EX, PX, NX, XX), DEL, EXISTS,
+// EXPIRE, PEXPIRE, TTL, PTTL, DBSIZE, FLUSHDB and FLUSHALL. It holds a
+// single database and is meant for tests and development, not production:
+//
+//     srv := session.NewRESPServer()
+//     addr, err := srv.Start("127.0.0.1:0")
+//     defer srv.Close()
+//     provider := session.NewRedisSessionProvider(session.NewRESPClient(addr), "sess:", 3600, nil)
+type RESPServer struct {
+	lock     sync.Mutex
+	data     map[string]respEntry
+	listener net.Listener
+	conns    map[net.Conn]bool
+	closed   bool
+	wg       sync.WaitGroup
+	// Password required by AUTH, none if "".
+	Password string
+}
+
+type respEntry struct {
+	value []byte
+	// Zero if the key has no TTL.
+	expires time.Time
+}
+
+func NewRESPServer() *RESPServer {
+	return &RESPServer{data: make(map[string]respEntry), conns: make(map[net.Conn]bool)}
+}
+
+// Start listens on addr, like "127.0.0.1:0", and returns the address
+// listened on.
+func (s *RESPServer) Start(addr string) (string, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	s.lock.Lock()
+	s.listener = l
+	s.lock.Unlock()
+	s.wg.Add(1)
+	go s.serve(l)
+	return l.Addr().String(), nil
+}
+
+// Close stops listening and closes the connections.
+func (s *RESPServer) Close() error {
+	s.lock.Lock()
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.lock.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *RESPServer) serve(l net.Listener) {
+	defer s.wg.Done()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		s.lock.Lock()
+		if s.closed {
+			s.lock.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = true
+		s.lock.Unlock()
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+func (s *RESPServer) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.lock.Lock()
+		delete(s.conns, conn)
+		s.lock.Unlock()
+		conn.Close()
+	}()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	authed := s.Password == ""
+	for {
+		v, err := readRESPValue(r)
+		if err != nil {
+			return
+		}
+		a, ok := v.([]interface{})
+		if !ok || len(a) == 0 {
+			writeRESPReply(w, RESPError("ERR protocol error, expected an array of bulk strings"))
+			w.Flush()
+			return
+		}
+		args := make([][]byte, len(a))
+		for i, arg := range a {
+			if args[i], ok = arg.([]byte); !ok {
+				writeRESPReply(w, RESPError("ERR protocol error, expected an array of bulk strings"))
+				w.Flush()
+				return
+			}
+		}
+		cmd := strings.ToUpper(string(args[0]))
+		var reply interface{}
+		switch {
+		case cmd == "AUTH":
+			if len(args) == 2 && string(args[1]) == s.Password {
+				authed = true
+				reply = "OK"
+			} else {
+				reply = RESPError("WRONGPASS invalid password")
+			}
+		case !authed:
+			reply = RESPError("NOAUTH Authentication required.")
+		default:
+			reply = s.exec(cmd, args[1:])
+		}
+		writeRESPReply(w, reply)
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeRESPReply writes a reply, the types are the ones of readRESPValue.
+func writeRESPReply(w *bufio.Writer, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case string:
+		w.WriteString("+" + v + "\r\n")
+	case RESPError:
+		w.WriteString("-" + string(v) + "\r\n")
+	case int64:
+		w.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+	case []byte:
+		w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n")
+		w.Write(v)
+		w.WriteString("\r\n")
+	case []interface{}:
+		w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, e := range v {
+			writeRESPReply(w, e)
+		}
+	}
+}
+
+func errRESPArgs(cmd string) RESPError {
+	return RESPError("ERR wrong number of arguments for '" + strings.ToLower(cmd) + "' command")
+}
+
+var errRESPSyntax = RESPError("ERR syntax error")
+
+// lookup returns the entry of a key, removing it if expired. The lock must
+// be held.
+func (s *RESPServer) lookup(key string, now time.Time) (respEntry, bool) {
+	e, ok := s.data[key]
+	if ok && !e.expires.IsZero() && !now.Before(e.expires) {
+		delete(s.data, key)
+		return respEntry{}, false
+	}
+	return e, ok
+}
+
+func (s *RESPServer) exec(cmd string, args [][]byte) interface{} {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+
+	switch cmd {
+	case "PING":
+		if len(args) == 1 {
+			return args[0]
+		}
+		return "PONG"
+	case "ECHO":
+		if len(args) != 1 {
+			return errRESPArgs(cmd)
+		}
+		return args[0]
+	case "SELECT":
+		if len(args) != 1 {
+			return errRESPArgs(cmd)
+		}
+		if string(args[0]) != "0" {
+			return RESPError("ERR DB index is out of range")
+		}
+		return "OK"
+	case "GET":
+		if len(args) != 1 {
+			return errRESPArgs(cmd)
+		}
+		if e, ok := s.lookup(string(args[0]), now); ok {
+			return e.value
+		}
+		return nil
+	case "GETEX":
+		if len(args) < 1 {
+			return errRESPArgs(cmd)
+		}
+		key := string(args[0])
+		e, ok := s.lookup(key, now)
+		if len(args) > 1 {
+			switch opt := strings.ToUpper(string(args[1])); {
+			case opt == "PERSIST" && len(args) == 2:
+				e.expires = time.Time{}
+			case (opt == "EX" || opt == "PX") && len(args) == 3:
+				n, err := strconv.ParseInt(string(args[2]), 10, 64)
+				if err != nil || n <= 0 {
+					return RESPError("ERR invalid expire time in 'getex' command")
+				}
+				unit := time.Second
+				if opt == "PX" {
+					unit = time.Millisecond
+				}
+				e.expires = now.Add(time.Duration(n) * unit)
+			default:
+				return errRESPSyntax
+			}
+		}
+		if !ok {
+			return nil
+		}
+		s.data[key] = e
+		return e.value
+	case "SET":
+		if len(args) < 2 {
+			return errRESPArgs(cmd)
+		}
+		key := string(args[0])
+		e := respEntry{value: append([]byte(nil), args[1]...)}
+		var nx, xx bool
+		for i := 2; i < len(args); i++ {
+			switch opt := strings.ToUpper(string(args[i])); opt {
+			case "NX":
+				nx = true
+			case "XX":
+				xx = true
+			case "EX", "PX":
+				if i+1 >= len(args) {
+					return errRESPSyntax
+				}
+				i++
+				n, err := strconv.ParseInt(string(args[i]), 10, 64)
+				if err != nil || n <= 0 {
+					return RESPError("ERR invalid expire time in 'set' command")
+				}
+				unit := time.Second
+				if opt == "PX" {
+					unit = time.Millisecond
+				}
+				e.expires = now.Add(time.Duration(n) * unit)
+			default:
+				return errRESPSyntax
+			}
+		}
+		_, exists := s.lookup(key, now)
+		if (nx && exists) || (xx && !exists) {
+			return nil
+		}
+		s.data[key] = e
+		return "OK"
+	case "DEL", "EXISTS":
+		if len(args) < 1 {
+			return errRESPArgs(cmd)
+		}
+		var n int64
+		for _, key := range args {
+			if _, ok := s.lookup(string(key), now); ok {
+				n++
+				if cmd == "DEL" {
+					delete(s.data, string(key))
+				}
+			}
+		}
+		return n
+	case "EXPIRE", "PEXPIRE":
+		if len(args) != 2 {
+			return errRESPArgs(cmd)
+		}
+		n, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			return RESPError("ERR value is not an integer or out of range")
+		}
+		e, ok := s.lookup(string(args[0]), now)
+		if !ok {
+			return int64(0)
+		}
+		unit := time.Second
+		if cmd == "PEXPIRE" {
+			unit = time.Millisecond
+		}
+		if n <= 0 {
+			delete(s.data, string(args[0]))
+			return int64(1)
+		}
+		e.expires = now.Add(time.Duration(n) * unit)
+		s.data[string(args[0])] = e
+		return int64(1)
+	case "TTL", "PTTL":
+		if len(args) != 1 {
+			return errRESPArgs(cmd)
+		}
+		e, ok := s.lookup(string(args[0]), now)
+		if !ok {
+			return int64(-2)
+		}
+		if e.expires.IsZero() {
+			return int64(-1)
+		}
+		if cmd == "PTTL" {
+			return int64(e.expires.Sub(now) / time.Millisecond)
+		}
+		return int64((e.expires.Sub(now) + time.Second - 1) / time.Second)
+	case "DBSIZE":
+		for key := range s.data {
+			s.lookup(key, now)
+		}
+		return int64(len(s.data))
+	case "FLUSHDB", "FLUSHALL":
+		s.data = make(map[string]respEntry)
+		return "OK"
+	}
+	return RESPError("ERR unknown command '" + strings.ToLower(cmd) + "'")
+}
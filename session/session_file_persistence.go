@@ -12,6 +12,7 @@ import (
 type SessionFilePersistence struct {
 	lock     sync.RWMutex
 	savePath string
+	codec    codecValue
 }
 
 func NewSessionFilePersistence(savePath string) *SessionFilePersistence {
@@ -21,6 +22,20 @@ func NewSessionFilePersistence(savePath string) *SessionFilePersistence {
 	return fp
 }
 
+// SetCodec sets the codec of the sessions saved from now on, the files
+// saved with other codecs are still loaded.
+func (fp *SessionFilePersistence) SetCodec(c Codec) {
+	fp.codec.Store(c)
+}
+
+// Codec returns the codec of the saved sessions, nil for DefaultCodec.
+func (fp *SessionFilePersistence) Codec() Codec {
+	if fp == nil {
+		return nil
+	}
+	return fp.codec.Load()
+}
+
 func (fp *SessionFilePersistence) sidFilePath(sid string) string {
 	return path.Join(fp.savePath, sid)
 }
@@ -71,20 +86,29 @@ func LoadSessionAttributesFromFile(fp *SessionFilePersistence, sidFilePath strin
 }
 
 func (fp *SessionFilePersistence) Has(sid string) bool {
+	if fp == nil {
+		return false
+	}
 	_, err := os.Stat(path.Join(fp.savePath, sid))
 	return err == nil
 }
 
 func (fp *SessionFilePersistence) Remove(sid string) {
+	if fp == nil {
+		return
+	}
 	os.Remove(fp.sidFilePath(sid))
 }
 
 func (fp *SessionFilePersistence) Clear(sid string) {
+	if fp == nil {
+		return
+	}
 	os.Truncate(fp.sidFilePath(sid), 0)
 }
 
 func (fp *SessionFilePersistence) Save(attr SessionAttributes) error {
-	if attr == nil {
+	if fp == nil || attr == nil {
 		return nil
 	}
 	encoded, err := attr.Encode()
@@ -0,0 +1,128 @@
+// Package accesslog writes an access log line for each request served by a
+// route.Router:
+//
+//     r.Use(accesslog.New(os.Stdout, accesslog.Combined).Middleware())
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	. "github.com/fwis/goweb/sweb/context"
+	"github.com/fwis/goweb/sweb/route"
+)
+
+type Format int
+
+const (
+	// Common Log Format.
+	Common = Format(0)
+	// Combined Log Format, Common with the referer and user agent.
+	Combined = Format(1)
+	// One JSON object per line.
+	JSON = Format(2)
+)
+
+// Entry is what is logged for a request.
+type Entry struct {
+	Time       time.Time     `json:"time"`
+	IP         string        `json:"ip"`
+	Method     string        `json:"method"`
+	URI        string        `json:"uri"`
+	Proto      string        `json:"proto"`
+	Route      string        `json:"route,omitempty"`
+	Status     int           `json:"status"`
+	Bytes      int64         `json:"bytes"`
+	Compressed bool          `json:"compressed"`
+	Latency    time.Duration `json:"-"`
+	LatencyMs  float64       `json:"latency_ms"`
+	Referer    string        `json:"referer,omitempty"`
+	UserAgent  string        `json:"user_agent,omitempty"`
+}
+
+// Logger writes the access log to an io.Writer.
+type Logger struct {
+	out    io.Writer
+	format Format
+	lock   sync.Mutex
+}
+
+func New(out io.Writer, format Format) *Logger {
+	return &Logger{out: out, format: format}
+}
+
+// Middleware returns the route.Middleware logging the requests. Added with
+// Router.Use, it sees every request, including not found ones.
+func (l *Logger) Middleware() route.Middleware {
+	return func(next route.VHandler) route.VHandler {
+		return route.VHandlerFunc(func(w http.ResponseWriter, r *http.Request, v url.Values) {
+			start := time.Now()
+			sw := route.NewStatusWriter(w)
+			finished := false
+			defer func() {
+				status := sw.Status()
+				if !finished && status == 0 {
+					// The handler panicked.
+					status = http.StatusInternalServerError
+				} else if status == 0 {
+					status = http.StatusOK
+				}
+				entry := &Entry{
+					Time:       start,
+					IP:         (&Context{R: r}).IP(),
+					Method:     r.Method,
+					URI:        r.RequestURI,
+					Proto:      r.Proto,
+					Status:     status,
+					Bytes:      sw.Written(),
+					Compressed: sw.Compressed(),
+					Latency:    time.Since(start),
+					Referer:    r.Referer(),
+					UserAgent:  r.UserAgent(),
+				}
+				if entry.URI == "" {
+					entry.URI = r.URL.RequestURI()
+				}
+				if item := route.CurrentRoute(r); item != nil {
+					entry.Route = item.GetPathTemplate()
+				}
+				l.Log(entry)
+			}()
+			next.VServeHTTP(sw, r, v)
+			finished = true
+		})
+	}
+}
+
+// Log writes the entry in the logger format.
+func (l *Logger) Log(e *Entry) {
+	var line []byte
+	switch l.format {
+	case JSON:
+		e.LatencyMs = float64(e.Latency) / float64(time.Millisecond)
+		line, _ = json.Marshal(e)
+		line = append(line, '\n')
+	default:
+		size := "-"
+		if e.Bytes > 0 {
+			size = strconv.FormatInt(e.Bytes, 10)
+		}
+		s := fmt.Sprintf("%s - - [%s] %q %d %s", e.IP,
+			e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+			e.Method+" "+e.URI+" "+e.Proto, e.Status, size)
+		if l.format == Combined {
+			s += fmt.Sprintf(" %q %q", e.Referer, e.UserAgent)
+		}
+		line = []byte(s + "\n")
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.out.Write(line)
+}
@@ -7,6 +7,8 @@ import (
 	// "strconv"
 )
 
+// Deprecated: the router doesn't call it, route.Vars(r) returns the route
+// parameters of a request.
 type IRouteParamSetter interface {
     SetRouteParamters(url.Values)
 }
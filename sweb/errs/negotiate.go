@@ -0,0 +1,38 @@
+package errs
+
+import (
+	"strings"
+
+	. "github.com/fwis/goweb/sweb/context"
+)
+
+type negotiatedErrorHandle struct {
+	jsonHandle ErrorHandle
+	htmlHandle ErrorHandle
+}
+
+// NewNegotiatedErrorHandle returns an ErrorHandle replying through jsonHandle
+// to ajax requests and requests accepting JSON, through htmlHandle otherwise.
+//
+// The HTML renderer of the render package replies errors too, but its
+// HTMLRenderer interface doesn't include ErrorHandle, so it's asserted:
+//
+//     errs.NewNegotiatedErrorHandle(jsonRenderer, htmlRenderer.(errs.ErrorHandle))
+func NewNegotiatedErrorHandle(jsonHandle ErrorHandle, htmlHandle ErrorHandle) ErrorHandle {
+	return &negotiatedErrorHandle{jsonHandle: jsonHandle, htmlHandle: htmlHandle}
+}
+
+func (m *negotiatedErrorHandle) choose(context *Context) ErrorHandle {
+	if context.IsAjax() || strings.Contains(context.GetHeader("Accept"), "application/json") {
+		return m.jsonHandle
+	}
+	return m.htmlHandle
+}
+
+func (m *negotiatedErrorHandle) Error(context *Context, status int, desc string) {
+	m.choose(context).Error(context, status, desc)
+}
+
+func (m *negotiatedErrorHandle) Errorv(context *Context, status int, err error) {
+	m.choose(context).Errorv(context, status, err)
+}
@@ -0,0 +1,120 @@
+// Package logs is the leveled logger used by the goweb packages.
+//
+// Each package has its own logger, logs.Default() until replaced with its
+// SetLogger function, for example to silence it in tests:
+//
+//     render.SetLogger(logs.Discard)
+//     session.SetLogger(logs.New(os.Stdout, logs.LevelDebug))
+package logs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug = Level(0)
+	LevelInfo  = Level(1)
+	LevelWarn  = Level(2)
+	LevelError = Level(3)
+	// Logs nothing.
+	LevelOff = Level(4)
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return "OFF"
+}
+
+// Logger is a leveled logger. With returns a logger adding the key/value
+// pairs to each message, like the route or the session ID of a request.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+	With(keyvals ...interface{}) Logger
+}
+
+// Discard drops every message.
+var Discard Logger = discard{}
+
+type discard struct{}
+
+func (discard) Debugf(format string, args ...interface{}) {}
+func (discard) Infof(format string, args ...interface{})  {}
+func (discard) Warnf(format string, args ...interface{})  {}
+func (discard) Errorf(format string, args ...interface{}) {}
+func (d discard) With(keyvals ...interface{}) Logger      { return d }
+
+// Default returns a logger writing Info and above to stdout.
+func Default() Logger {
+	return New(os.Stdout, LevelInfo)
+}
+
+// New returns a logger writing the messages of level and above to out, one
+// per line:
+//
+//     2006/01/02 15:04:05 WARN message key=value
+func New(out io.Writer, level Level) Logger {
+	return &textLogger{out: out, level: level, lock: new(sync.Mutex)}
+}
+
+type textLogger struct {
+	out    io.Writer
+	level  Level
+	fields string
+	lock   *sync.Mutex
+}
+
+func (l *textLogger) log(level Level, format string, args []interface{}) {
+	if level < l.level {
+		return
+	}
+	msg := strings.TrimRight(fmt.Sprintf(format, args...), "\n")
+	line := time.Now().Format("2006/01/02 15:04:05") + " " + level.String() + " " + msg + l.fields + "\n"
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	io.WriteString(l.out, line)
+}
+
+func (l *textLogger) Debugf(format string, args ...interface{}) { l.log(LevelDebug, format, args) }
+func (l *textLogger) Infof(format string, args ...interface{})  { l.log(LevelInfo, format, args) }
+func (l *textLogger) Warnf(format string, args ...interface{})  { l.log(LevelWarn, format, args) }
+func (l *textLogger) Errorf(format string, args ...interface{}) { l.log(LevelError, format, args) }
+
+func (l *textLogger) With(keyvals ...interface{}) Logger {
+	if len(keyvals) == 0 {
+		return l
+	}
+	var b strings.Builder
+	b.WriteString(l.fields)
+	for i := 0; i < len(keyvals); i += 2 {
+		var v interface{} = "(MISSING)"
+		if i+1 < len(keyvals) {
+			v = keyvals[i+1]
+		}
+		s := fmt.Sprint(v)
+		if s == "" || strings.ContainsAny(s, " \"=") {
+			s = fmt.Sprintf("%q", s)
+		}
+		fmt.Fprintf(&b, " %v=%s", keyvals[i], s)
+	}
+	return &textLogger{out: l.out, level: l.level, fields: b.String(), lock: l.lock}
+}
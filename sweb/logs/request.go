@@ -0,0 +1,61 @@
+package logs
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	. "github.com/fwis/goweb/sweb/context"
+)
+
+type contextKey int
+
+const fieldsKey contextKey = 0
+
+// NewContext returns a context carrying the key/value pairs, added to the
+// ones of ctx, for ForRequest.
+func NewContext(ctx context.Context, keyvals ...interface{}) context.Context {
+	fields := ContextFields(ctx)
+	all := make([]interface{}, 0, len(fields)+len(keyvals))
+	all = append(append(all, fields...), keyvals...)
+	return context.WithValue(ctx, fieldsKey, all)
+}
+
+// ContextFields returns the key/value pairs added with NewContext.
+func ContextFields(ctx context.Context) []interface{} {
+	fields, _ := ctx.Value(fieldsKey).([]interface{})
+	return fields
+}
+
+var (
+	requestFields     []func(*http.Request) []interface{}
+	requestFieldsLock sync.RWMutex
+)
+
+// RegisterRequestFields adds a function returning key/value pairs for
+// ForRequest, the route package adds the matched route and the session
+// package the session this way.
+func RegisterRequestFields(f func(*http.Request) []interface{}) {
+	requestFieldsLock.Lock()
+	defer requestFieldsLock.Unlock()
+	requestFields = append(requestFields, f)
+}
+
+// ForRequest returns l with the fields of the request: the client IP, the
+// registered request fields and the context fields.
+func ForRequest(l Logger, r *http.Request) Logger {
+	if r == nil {
+		return l
+	}
+	if _, ok := l.(discard); ok {
+		return l
+	}
+	fields := []interface{}{"ip", (&Context{R: r}).IP()}
+	requestFieldsLock.RLock()
+	for _, f := range requestFields {
+		fields = append(fields, f(r)...)
+	}
+	requestFieldsLock.RUnlock()
+	fields = append(fields, ContextFields(r.Context())...)
+	return l.With(fields...)
+}
@@ -0,0 +1,34 @@
+//go:build go1.21
+
+package logs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// NewSlog returns a Logger writing to a log/slog logger.
+func NewSlog(l *slog.Logger) Logger {
+	return slogLogger{l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (s slogLogger) log(level slog.Level, format string, args []interface{}) {
+	if !s.l.Enabled(context.Background(), level) {
+		return
+	}
+	s.l.Log(context.Background(), level, fmt.Sprintf(format, args...))
+}
+
+func (s slogLogger) Debugf(format string, args ...interface{}) { s.log(slog.LevelDebug, format, args) }
+func (s slogLogger) Infof(format string, args ...interface{})  { s.log(slog.LevelInfo, format, args) }
+func (s slogLogger) Warnf(format string, args ...interface{})  { s.log(slog.LevelWarn, format, args) }
+func (s slogLogger) Errorf(format string, args ...interface{}) { s.log(slog.LevelError, format, args) }
+
+func (s slogLogger) With(keyvals ...interface{}) Logger {
+	return slogLogger{s.l.With(keyvals...)}
+}
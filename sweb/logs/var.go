@@ -0,0 +1,38 @@
+package logs
+
+import (
+	"sync/atomic"
+)
+
+var std = Default()
+
+// Var holds the logger of a package, Default() until Set. It can be Set
+// while requests are logging through it.
+//
+//     var logVar logs.Var
+//     func logger() logs.Logger { return logVar.Get() }
+type Var struct {
+	v atomic.Value
+}
+
+// loggerBox gives the stored loggers a single type, as atomic.Value
+// requires.
+type loggerBox struct {
+	l Logger
+}
+
+// Get returns the logger.
+func (lv *Var) Get() Logger {
+	if b, ok := lv.v.Load().(loggerBox); ok {
+		return b.l
+	}
+	return std
+}
+
+// Set replaces the logger, nil is Discard.
+func (lv *Var) Set(l Logger) {
+	if l == nil {
+		l = Discard
+	}
+	lv.v.Store(loggerBox{l})
+}
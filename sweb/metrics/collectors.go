@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/fwis/goweb/sweb/route"
+	"github.com/fwis/goweb/sweb/static"
+	"github.com/fwis/goweb/sweb/zip"
+)
+
+// SizeBuckets are the default response size buckets, in bytes.
+var SizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+
+// RouteMiddleware returns the route.Middleware counting the requests and
+// observing their latency and response size, labelled by the path template of
+// the matched route, so /users/{id} is one series whatever the id. Requests
+// not matching any route are labelled "none".
+//
+// Added with Router.Use, it sees every request:
+//
+//     http_requests_total{method,route,status}
+//     http_request_duration_seconds{method,route}
+//     http_response_size_bytes{method,route}
+func (reg *Registry) RouteMiddleware() route.Middleware {
+	requests := reg.NewCounterVec("http_requests_total",
+		"Requests served, by route template and status.", "method", "route", "status")
+	durations := reg.NewHistogramVec("http_request_duration_seconds",
+		"Latency of the requests, by route template.", nil, "method", "route")
+	sizes := reg.NewHistogramVec("http_response_size_bytes",
+		"Size of the response bodies as written, by route template.", SizeBuckets, "method", "route")
+
+	return func(next route.VHandler) route.VHandler {
+		return route.VHandlerFunc(func(w http.ResponseWriter, r *http.Request, v url.Values) {
+			start := time.Now()
+			sw := route.NewStatusWriter(w)
+			finished := false
+			defer func() {
+				status := sw.Status()
+				if !finished && status == 0 {
+					// The handler panicked.
+					status = http.StatusInternalServerError
+				} else if status == 0 {
+					status = http.StatusOK
+				}
+				tpl := "none"
+				if item := route.CurrentRoute(r); item != nil {
+					if tpl = item.GetPathTemplate(); tpl == "" {
+						tpl = "*"
+					}
+				}
+				method := normalizeMethod(r.Method)
+				requests.Inc(method, tpl, strconv.Itoa(status))
+				durations.Observe(time.Since(start).Seconds(), method, tpl)
+				sizes.Observe(float64(sw.Written()), method, tpl)
+			}()
+			next.VServeHTTP(sw, r, v)
+			finished = true
+		})
+	}
+}
+
+// normalizeMethod keeps the label cardinality bounded whatever the clients send.
+func normalizeMethod(m string) string {
+	switch m {
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "CONNECT", "TRACE":
+		return m
+	}
+	return "OTHER"
+}
+
+// ObserveZip sets the sweb/zip observer to count the bytes compressed by
+// GzipWrite, DeflateWrite and the writers of NewGzipWriter and
+// NewDefalteWriter, before and after compression, by encoding.
+// zip has a single observer, so only one Registry can observe it.
+//
+//     zip_uncompressed_bytes_total{encoding}
+//     zip_compressed_bytes_total{encoding}
+func (reg *Registry) ObserveZip() {
+	uncompressed := reg.NewCounterVec("zip_uncompressed_bytes_total",
+		"Bytes given to the compressors, by encoding.", "encoding")
+	compressed := reg.NewCounterVec("zip_compressed_bytes_total",
+		"Bytes written by the compressors, by encoding.", "encoding")
+	zip.SetObserver(func(encoding string, in, out int64) {
+		uncompressed.Add(float64(in), encoding)
+		compressed.Add(float64(out), encoding)
+	})
+}
+
+// SessionCounter is a session provider counting its sessions, like
+// session.MemSessionProvider. If it also has an Evictions() int64 method, the
+// expired sessions it removed are exported too.
+type SessionCounter interface {
+	Len() int
+}
+
+// ObserveSessions exports the number of sessions of the provider and, if it
+// counts them, the expired sessions removed by its GC.
+//
+//     session_active
+//     session_evictions_total
+func (reg *Registry) ObserveSessions(p SessionCounter) {
+	reg.GaugeFunc("session_active", "Sessions held by the provider.", func() float64 {
+		return float64(p.Len())
+	})
+	if e, ok := p.(interface{ Evictions() int64 }); ok {
+		reg.CounterFunc("session_evictions_total", "Expired sessions removed by the GC.", func() float64 {
+			return float64(e.Evictions())
+		})
+	}
+}
+
+// ObserveStaticCache exports the hits and misses of the static.OpenMemZipFile
+// cache.
+//
+//     static_cache_hits_total
+//     static_cache_misses_total
+func (reg *Registry) ObserveStaticCache() {
+	reg.CounterFunc("static_cache_hits_total", "Files served from the memory cache.", func() float64 {
+		hits, _ := static.MemZipCacheStats()
+		return float64(hits)
+	})
+	reg.CounterFunc("static_cache_misses_total", "Files read from disk into the memory cache.", func() float64 {
+		_, misses := static.MemZipCacheStats()
+		return float64(misses)
+	})
+}
@@ -0,0 +1,366 @@
+// Package metrics collects counters, gauges and histograms and serves them in
+// the Prometheus text exposition format (version 0.0.4):
+//
+//     reg := metrics.NewRegistry()
+//     r.Use(reg.RouteMiddleware())
+//     reg.ObserveZip()
+//     reg.ObserveSessions(provider)
+//     reg.ObserveStaticCache()
+//     r.VGET("/metrics", route.WrapHandlerAsV(reg))
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets are the default histogram buckets, in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metric is a family of samples with the same name.
+type metric interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry holds the metrics and serves them.
+type Registry struct {
+	lock    sync.RWMutex
+	metrics []metric
+	names   map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// register adds m, it panics if the name is invalid or already registered.
+func (reg *Registry) register(m metric) {
+	if !validName(m.name()) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", m.name()))
+	}
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+	if reg.names[m.name()] {
+		panic(fmt.Sprintf("metrics: duplicate metric %q", m.name()))
+	}
+	reg.names[m.name()] = true
+	reg.metrics = append(reg.metrics, m)
+}
+
+// WriteTo writes all the metrics in the text exposition format.
+func (reg *Registry) WriteTo(w io.Writer) (int64, error) {
+	reg.lock.RLock()
+	metrics := append([]metric(nil), reg.metrics...)
+	reg.lock.RUnlock()
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].name() < metrics[j].name()
+	})
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.Method == "HEAD" {
+		return
+	}
+	reg.WriteTo(w)
+}
+
+// ----------------------------------------------------------------------------
+// CounterVec
+// ----------------------------------------------------------------------------
+
+// CounterVec is a counter partitioned by label values.
+type CounterVec struct {
+	desc
+	lock   sync.Mutex
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labels []string
+	value  float64
+}
+
+// NewCounterVec registers a counter with the label names.
+func (reg *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{desc: newDesc(name, help, "counter", labels), values: make(map[string]*counterValue)}
+	reg.register(c)
+	return c
+}
+
+// Add adds v, which must not be negative, to the counter of the label values.
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	key := c.key(labelValues)
+	c.lock.Lock()
+	cv := c.values[key]
+	if cv == nil {
+		cv = &counterValue{labels: append([]string(nil), labelValues...)}
+		c.values[key] = cv
+	}
+	cv.value += v
+	c.lock.Unlock()
+}
+
+// Inc adds 1 to the counter of the label values.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.header(w)
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	for _, key := range sortKeys(keys) {
+		cv := c.values[key]
+		c.sample(w, c.fqname, cv.labels, "", "", cv.value)
+	}
+}
+
+// ----------------------------------------------------------------------------
+// HistogramVec
+// ----------------------------------------------------------------------------
+
+// HistogramVec is a histogram partitioned by label values.
+type HistogramVec struct {
+	desc
+	buckets []float64
+	lock    sync.Mutex
+	values  map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labels []string
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec registers a histogram with the bucket upper bounds, in
+// increasing order, and the label names. nil buckets means DefBuckets.
+func (reg *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	if n := len(buckets); n > 0 && math.IsInf(buckets[n-1], 1) {
+		buckets = buckets[:n-1]
+	}
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			panic(fmt.Sprintf("metrics: buckets of %q are not increasing", name))
+		}
+	}
+	h := &HistogramVec{desc: newDesc(name, help, "histogram", labels), buckets: buckets, values: make(map[string]*histogramValue)}
+	reg.register(h)
+	return h
+}
+
+// Observe adds v to the histogram of the label values.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.lock.Lock()
+	hv := h.values[key]
+	if hv == nil {
+		hv = &histogramValue{labels: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets)+1)}
+		h.values[key] = hv
+	}
+	hv.counts[i]++
+	hv.count++
+	hv.sum += v
+	h.lock.Unlock()
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.header(w)
+	keys := make([]string, 0, len(h.values))
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	for _, key := range sortKeys(keys) {
+		hv := h.values[key]
+		var cumul uint64
+		for i, upper := range h.buckets {
+			cumul += hv.counts[i]
+			h.sample(w, h.fqname+"_bucket", hv.labels, "le", formatFloat(upper), float64(cumul))
+		}
+		h.sample(w, h.fqname+"_bucket", hv.labels, "le", "+Inf", float64(hv.count))
+		h.sample(w, h.fqname+"_sum", hv.labels, "", "", hv.sum)
+		h.sample(w, h.fqname+"_count", hv.labels, "", "", float64(hv.count))
+	}
+}
+
+// ----------------------------------------------------------------------------
+// GaugeFunc and CounterFunc
+// ----------------------------------------------------------------------------
+
+// valueFunc is a metric without labels whose value is read when collected.
+type valueFunc struct {
+	desc
+	f func() float64
+}
+
+// GaugeFunc registers a gauge whose value is returned by f.
+func (reg *Registry) GaugeFunc(name, help string, f func() float64) {
+	reg.register(&valueFunc{newDesc(name, help, "gauge", nil), f})
+}
+
+// CounterFunc registers a counter whose value is returned by f, which must
+// never decrease.
+func (reg *Registry) CounterFunc(name, help string, f func() float64) {
+	reg.register(&valueFunc{newDesc(name, help, "counter", nil), f})
+}
+
+func (m *valueFunc) write(w *bufio.Writer) {
+	m.header(w)
+	m.sample(w, m.fqname, nil, "", "", m.f())
+}
+
+// ----------------------------------------------------------------------------
+// desc
+// ----------------------------------------------------------------------------
+
+// desc is the name, help, type and label names of a metric.
+type desc struct {
+	fqname string
+	help   string
+	typ    string
+	labels []string
+}
+
+func newDesc(name, help, typ string, labels []string) desc {
+	for _, l := range labels {
+		if !validName(l) || strings.Contains(l, ":") || strings.HasPrefix(l, "__") || l == "le" {
+			panic(fmt.Sprintf("metrics: invalid label name %q", l))
+		}
+	}
+	return desc{fqname: name, help: help, typ: typ, labels: append([]string(nil), labels...)}
+}
+
+func (d *desc) name() string {
+	return d.fqname
+}
+
+// key checks the number of label values and joins them into a map key.
+func (d *desc) key(labelValues []string) string {
+	if len(labelValues) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %q has %d labels, got %d values", d.fqname, len(d.labels), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+func (d *desc) header(w *bufio.Writer) {
+	if d.help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", d.fqname, helpEscaper.Replace(d.help))
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.fqname, d.typ)
+}
+
+// sample writes a sample line, extraName and extraValue is an additional
+// label, such as the le of histogram buckets.
+func (d *desc) sample(w *bufio.Writer, name string, values []string, extraName, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(values) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, value := range values {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, d.labels[i], value)
+		}
+		if extraName != "" {
+			if len(values) > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, extraName, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func writeLabel(w *bufio.Writer, name, value string) {
+	w.WriteString(name)
+	w.WriteString(`="`)
+	w.WriteString(labelEscaper.Replace(value))
+	w.WriteByte('"')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// validName reports whether s matches [a-zA-Z_:][a-zA-Z0-9_:]*.
+func validName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == ':':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func sortKeys(keys []string) []string {
+	sort.Strings(keys)
+	return keys
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,217 @@
+// Package ratelimit limits the request rate per client with token buckets.
+//
+// A Limiter is a route.Filter, and a route.Middleware through Middleware, so
+// it can be set on a Router, a RouteGroup or a single RouteItem:
+//
+//     limiter := ratelimit.NewLimiter(5, 20, ratelimit.KeyByIP)
+//     r.VPOST("/login", loginHandler).Use(limiter.Middleware())
+package ratelimit
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fwis/goweb/session"
+	. "github.com/fwis/goweb/sweb/context"
+	"github.com/fwis/goweb/sweb/errs"
+	"github.com/fwis/goweb/sweb/route"
+)
+
+// KeyFunc returns the key the requests are counted by, "" to not limit the
+// request.
+type KeyFunc func(r *http.Request) string
+
+// KeyByIP counts the requests by the IP of the peer, req.RemoteAddr. The
+// X-Forwarded-For header is ignored, any client could set it; behind a
+// reverse proxy, use KeyByForwardedIP.
+func KeyByIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// KeyByForwardedIP counts the requests by client IP behind the reverse
+// proxies in cidrs, networks in CIDR notation or single IPs. For requests
+// from these proxies, the client IP is the rightmost X-Forwarded-For address
+// not in cidrs, the addresses on its left may be spoofed by the client. Other
+// requests are counted by KeyByIP.
+func KeyByForwardedIP(cidrs ...string) (KeyFunc, error) {
+	proxies, err := route.ParseTrustedProxies(cidrs...)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(r *http.Request) string {
+		client := KeyByIP(r)
+		if ip := net.ParseIP(client); ip == nil || !proxies.Contains(ip) {
+			return client
+		}
+		var hops []string
+		for _, line := range r.Header.Values("X-Forwarded-For") {
+			hops = append(hops, strings.Split(line, ",")...)
+		}
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			client = ip.String()
+			if !proxies.Contains(ip) {
+				break
+			}
+		}
+		return client
+	}, nil
+}
+
+// KeyBySession counts the requests by session, by fallback for requests
+// without a valid session. The key is the ID of the session loaded by the
+// provider, not the cookie: a CookieSessionProvider cookie changes with each
+// save, and clients can't get fresh buckets with made up or replayed cookies.
+// fallback is KeyByIP if nil.
+func KeyBySession(mgr *session.SessionMgrUsingCookie, fallback KeyFunc) KeyFunc {
+	if fallback == nil {
+		fallback = KeyByIP
+	}
+	return func(r *http.Request) string {
+		if cookie, err := mgr.GetSessionCookie(r); err == nil && cookie != "" {
+			if sxn, err := mgr.GetSession(cookie); err == nil && sxn != nil && sxn.SessionID() != "" {
+				return "sid:" + sxn.SessionID()
+			}
+		}
+		return "ip:" + fallback(r)
+	}
+}
+
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// Limiter allows rate requests per second per key, with bursts of up to
+// burst requests.
+type Limiter struct {
+	rate  float64
+	burst int
+	key   KeyFunc
+
+	// Replies the 429 errors, the default ErrorHandle if nil.
+	ErrorHandle errs.ErrorHandle
+	// Buckets kept at most, the least recently used are evicted first.
+	MaxKeys int
+
+	lock    sync.Mutex
+	buckets map[string]*list.Element
+	// Buckets by last use, most recent first.
+	lru *list.List
+}
+
+// NewLimiter returns a Limiter, key is KeyByIP if nil. It panics if rate is
+// not positive.
+func NewLimiter(rate float64, burst int, key KeyFunc) *Limiter {
+	if !(rate > 0) {
+		panic(fmt.Sprintf("ratelimit: rate %v is not positive", rate))
+	}
+	if key == nil {
+		key = KeyByIP
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:    rate,
+		burst:   burst,
+		key:     key,
+		MaxKeys: 100000,
+		buckets: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Allow takes a token for the key. It returns whether the request is
+// allowed, the tokens left and the time to wait for the next token.
+func (l *Limiter) Allow(key string) (bool, int, time.Duration) {
+	now := time.Now()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.evict(now)
+	var b *bucket
+	if e, ok := l.buckets[key]; ok {
+		l.lru.MoveToFront(e)
+		b = e.Value.(*bucket)
+		b.tokens = math.Min(float64(l.burst), b.tokens+now.Sub(b.last).Seconds()*l.rate)
+		b.last = now
+	} else {
+		b = &bucket{key: key, tokens: float64(l.burst), last: now}
+		l.buckets[key] = l.lru.PushFront(b)
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, int(b.tokens), 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, 0, wait
+}
+
+// evict drops the least recently used buckets while they are full again,
+// they are the same as new ones, or while there are MaxKeys buckets or more.
+// Each bucket is dropped once, so it costs O(1) per request amortized.
+func (l *Limiter) evict(now time.Time) {
+	full := time.Duration(float64(l.burst) / l.rate * float64(time.Second))
+	for e := l.lru.Back(); e != nil; e = l.lru.Back() {
+		b := e.Value.(*bucket)
+		if now.Sub(b.last) < full && (l.MaxKeys <= 0 || len(l.buckets) < l.MaxKeys) {
+			return
+		}
+		l.lru.Remove(e)
+		delete(l.buckets, b.key)
+	}
+}
+
+// FilterHTTP implements route.Filter, it replies 429 Too Many Requests and
+// returns false when the client is over its rate.
+func (l *Limiter) FilterHTTP(w http.ResponseWriter, r *http.Request) bool {
+	key := l.key(r)
+	if key == "" {
+		return true
+	}
+	ok, remaining, wait := l.Allow(key)
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(l.burst))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	if ok {
+		return true
+	}
+	retry := int64(math.Ceil(wait.Seconds()))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Unix()+retry, 10))
+	w.Header().Set("Retry-After", strconv.FormatInt(retry, 10))
+
+	errHandle := l.ErrorHandle
+	if errHandle == nil {
+		errHandle = errs.NewDefaultErrorHandle()
+	}
+	errHandle.Error(&Context{R: r, W: w}, http.StatusTooManyRequests, http.StatusText(http.StatusTooManyRequests))
+	return false
+}
+
+// Middleware returns the Limiter as a route.Middleware.
+func (l *Limiter) Middleware() route.Middleware {
+	return func(next route.VHandler) route.VHandler {
+		return route.VHandlerFunc(func(w http.ResponseWriter, r *http.Request, v url.Values) {
+			if l.FilterHTTP(w, r) {
+				next.VServeHTTP(w, r, v)
+			}
+		})
+	}
+}
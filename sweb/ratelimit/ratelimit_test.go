@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fwis/goweb/session"
+)
+
+// TestKeyBySessionCookieProvider checks the cookies of one session share a
+// key, while the CookieSessionProvider reseals them on each save.
+func TestKeyBySessionCookieProvider(t *testing.T) {
+	pder, err := session.NewCookieSessionProvider(3600, "sha256", []string{"0123456789abcdef0123456789abcdef"}, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr, err := session.NewSessionMgrUsingCookie(pder, "sid", 0, "localhost", true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr.Sliding = true
+	key := KeyBySession(mgr, nil)
+
+	withCookie := func(value string) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		r.AddCookie(&http.Cookie{Name: "sid", Value: value})
+		return r
+	}
+
+	attrs := pder.NewSessionAttributes("s1")
+	attrs.Set("uid", "42")
+	sxn, err := pder.GetSession(mustSeal(t, pder, "s1", attrs))
+	if err != nil || sxn == nil {
+		t.Fatal(sxn, err)
+	}
+	first := mustSeal(t, pder, "s1", sxn.Attributes())
+	sxn.Attributes().SetTimeAccessed(time.Now())
+	second := mustSeal(t, pder, "s1", sxn.Attributes())
+	if first == second {
+		t.Fatal("the cookie was not resealed")
+	}
+
+	if k1, k2 := key(withCookie(first)), key(withCookie(second)); k1 != "sid:s1" || k2 != k1 {
+		t.Errorf("keys of the same session: %q and %q, want sid:s1", k1, k2)
+	}
+	if k := key(withCookie("made-up")); k != "ip:192.0.2.1" {
+		t.Errorf("key of a made up cookie: %q, want ip:192.0.2.1", k)
+	}
+}
+
+func mustSeal(t *testing.T, pder *session.CookieSessionProvider, sid string, attrs session.SessionAttributes) string {
+	value, err := pder.Seal(&testSession{sid: sid, attrs: attrs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+type testSession struct {
+	sid   string
+	attrs session.SessionAttributes
+}
+
+func (s *testSession) Attributes() session.SessionAttributes         { return s.attrs }
+func (s *testSession) SetAttributes(attrs session.SessionAttributes) { s.attrs = attrs }
+func (s *testSession) SessionID() string                             { return s.sid }
@@ -1,13 +1,13 @@
 package render
 
 import (
-	"fmt"
 	"html/template"
 	"net/http"
 	"strconv"
 
 	. "github.com/fwis/goweb/sweb/context"
 	. "github.com/fwis/goweb/sweb/errs"
+	"github.com/fwis/goweb/sweb/logs"
 	"github.com/fwis/goweb/sweb/zip"
 )
 
@@ -82,13 +82,13 @@ func (m *htmlRenderer) RenderRaw(context *Context, raw []byte) {
 			if encoding == zip.ENCODING_GZIP {
 				_, err := zip.GzipWrite(context.W, m.option.GzipLevel, raw)
 				if err != nil {
-					fmt.Printf("htmlRenderer GzipWrite err=%v\n", err)
+					logs.ForRequest(logger(), context.R).Errorf("htmlRenderer GzipWrite err=%v", err)
 				}
 				written = true
 			} else if encoding == zip.ENCODING_DEFLATE {
 				_, err := zip.DeflateWrite(context.W, m.option.DeflateLevel, raw)
 				if err != nil {
-					fmt.Printf("htmlRenderer DeflateWrite err=%v\n", err)
+					logs.ForRequest(logger(), context.R).Errorf("htmlRenderer DeflateWrite err=%v", err)
 				}
 				written = true
 			}
@@ -104,7 +104,7 @@ func (m *htmlRenderer) RenderRaw(context *Context, raw []byte) {
 func (m *htmlRenderer) Render(context *Context, xable interface{}, tplName string, tplLayout string, data interface{}) {
 	icontent, err := m.engine.Render(tplName, tplLayout, data)
 	if err != nil {
-		fmt.Printf("htmlRenderer Render %s err=%v\n", tplName, err)
+		logs.ForRequest(logger(), context.R).Errorf("htmlRenderer Render %s err=%v", tplName, err)
 		http.Error(context.W, "System render html template error", http.StatusInternalServerError)
 		return
 	}
@@ -121,13 +121,13 @@ func (m *htmlRenderer) Render(context *Context, xable interface{}, tplName strin
 			if encoding == zip.ENCODING_GZIP {
 				_, err := zip.GzipWrite(context.W, m.option.GzipLevel, icontent)
 				if err != nil {
-					fmt.Printf("htmlRenderer GzipWrite err=%v\n", err)
+					logs.ForRequest(logger(), context.R).Errorf("htmlRenderer GzipWrite err=%v", err)
 				}
 				written = true
 			} else if encoding == zip.ENCODING_DEFLATE {
 				_, err := zip.DeflateWrite(context.W, m.option.DeflateLevel, icontent)
 				if err != nil {
-					fmt.Printf("htmlRenderer DeflateWrite err=%v\n", err)
+					logs.ForRequest(logger(), context.R).Errorf("htmlRenderer DeflateWrite err=%v", err)
 				}
 				written = true
 			}
@@ -2,12 +2,12 @@ package render
 
 import (
 	"container/list"
-	"fmt"
 	"net/http"
 	"strconv"
 
 	. "github.com/fwis/goweb/sweb/context"
 	. "github.com/fwis/goweb/sweb/errs"
+	"github.com/fwis/goweb/sweb/logs"
 	. "github.com/fwis/goweb/sweb/pagination"
 	"github.com/fwis/goweb/sweb/zip"
 )
@@ -42,13 +42,13 @@ func (m *jsonRenderer) _write(context *Context, icontent []byte) {
 			if encoding == zip.ENCODING_GZIP {
 				_, err := zip.GzipWrite(context.W, m.option.GzipLevel, icontent)
 				if err != nil {
-					fmt.Printf("jsonRenderer GzipWrite err=%v\n", err)
+					logs.ForRequest(logger(), context.R).Errorf("jsonRenderer GzipWrite err=%v", err)
 				}
 				written = true
 			} else if encoding == zip.ENCODING_DEFLATE {
 				_, err := zip.DeflateWrite(context.W, m.option.DeflateLevel, icontent)
 				if err != nil {
-					fmt.Printf("jsonRenderer DeflateWrite err=%v\n", err)
+					logs.ForRequest(logger(), context.R).Errorf("jsonRenderer DeflateWrite err=%v", err)
 				}
 				written = true
 			}
@@ -62,7 +62,7 @@ func (m *jsonRenderer) _write(context *Context, icontent []byte) {
 }
 
 func (m *jsonRenderer) Error(ctx *Context, status int, msg string) {
-	fmt.Printf("jsonRenderer Error, status=%d msg=%s\n", status, msg)
+	logs.ForRequest(logger(), ctx.R).Errorf("jsonRenderer Error, status=%d msg=%s", status, msg)
 	if status == 0 {
 		status = http.StatusInternalServerError
 	}
@@ -71,7 +71,7 @@ func (m *jsonRenderer) Error(ctx *Context, status int, msg string) {
 }
 
 func (m *jsonRenderer) Errorv(ctx *Context, status int, err error) {
-	fmt.Printf("jsonRenderer Errorv, status=%d err=%v\n", status, err)
+	logs.ForRequest(logger(), ctx.R).Errorf("jsonRenderer Errorv, status=%d err=%v", status, err)
 	if status == 0 {
 		status = http.StatusInternalServerError
 	}
@@ -103,7 +103,7 @@ func (m *jsonRenderer) RenderJson(ctx *Context, p *Pagination, jsonbytes []byte)
 func (m *jsonRenderer) RenderData(ctx *Context, p *Pagination, objs interface{}) {
 	icontent, err := m.engine.DataObjs(p, objs)
 	if err != nil {
-		fmt.Printf("jsonRenderer RenderData, err=%v, objs=%v\n", err, objs)
+		logs.ForRequest(logger(), ctx.R).Errorf("jsonRenderer RenderData, err=%v, objs=%v", err, objs)
 		m.engine.Error(http.StatusInternalServerError, "系统异常")
 	} else {
 		m._write(ctx, icontent)
@@ -113,7 +113,7 @@ func (m *jsonRenderer) RenderData(ctx *Context, p *Pagination, objs interface{})
 func (m *jsonRenderer) RenderList(ctx *Context, p *Pagination, list *list.List) {
 	icontent, err := m.engine.DataList(p, list)
 	if err != nil {
-		fmt.Printf("jsonRenderer RenderList, err=%v, list=%v\n", err, list)
+		logs.ForRequest(logger(), ctx.R).Errorf("jsonRenderer RenderList, err=%v, list=%v", err, list)
 		m.engine.Error(http.StatusInternalServerError, "系统异常")
 	} else {
 		m._write(ctx, icontent)
@@ -0,0 +1,120 @@
+package route
+
+import (
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/fwis/goweb/sweb/errs"
+)
+
+// Converter is a named variable type usable in route templates as
+// {name:type}, for example {id:int}.
+type Converter struct {
+	// Regexp the variable must match in the URL.
+	Pattern string
+	// Parse converts the matched value, used by Convert. It may be nil.
+	Parse func(string) (interface{}, error)
+}
+
+var (
+	converters = map[string]Converter{
+		"int":  {Pattern: `-?[0-9]+`, Parse: parseInt64},
+		"uint": {Pattern: `[0-9]+`, Parse: parseUint64},
+		"slug": {Pattern: `[a-z0-9]+(?:-[a-z0-9]+)*`},
+		"uuid": {Pattern: `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`},
+	}
+	convertersLock sync.RWMutex
+)
+
+// RegisterConverter adds or replaces a converter. Routes are compiled when
+// registered, so it must be called before the routes using it.
+func RegisterConverter(name string, c Converter) {
+	convertersLock.Lock()
+	defer convertersLock.Unlock()
+	converters[name] = c
+}
+
+func lookupConverter(name string) (Converter, bool) {
+	convertersLock.RLock()
+	defer convertersLock.RUnlock()
+	c, ok := converters[name]
+	return c, ok
+}
+
+func parseInt64(s string) (interface{}, error) {
+	return strconv.ParseInt(s, 10, 64)
+}
+
+func parseUint64(s string) (interface{}, error) {
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// Convert parses the route parameter with the named converter.
+func Convert(v url.Values, key string, converter string) (interface{}, *errs.PubError) {
+	c, ok := lookupConverter(converter)
+	if !ok || c.Parse == nil {
+		return nil, errs.PubErrorf("route parameter %q: unknown converter %q", key, converter)
+	}
+	s, perr := requiredParam(v, key)
+	if perr != nil {
+		return nil, perr
+	}
+	i, err := c.Parse(s)
+	if err != nil {
+		return nil, errs.PubErrorf("route parameter %q is not a valid %s", key, converter)
+	}
+	return i, nil
+}
+
+// String returns the route parameter, it must not be empty.
+func String(v url.Values, key string) (string, *errs.PubError) {
+	return requiredParam(v, key)
+}
+
+// Int64 parses the route parameter as a base 10 integer.
+func Int64(v url.Values, key string) (int64, *errs.PubError) {
+	s, perr := requiredParam(v, key)
+	if perr != nil {
+		return 0, perr
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, errs.PubErrorf("route parameter %q is not an integer", key)
+	}
+	return i, nil
+}
+
+// Int parses the route parameter as a base 10 integer.
+func Int(v url.Values, key string) (int, *errs.PubError) {
+	s, perr := requiredParam(v, key)
+	if perr != nil {
+		return 0, perr
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, errs.PubErrorf("route parameter %q is not an integer", key)
+	}
+	return i, nil
+}
+
+// Uint64 parses the route parameter as a base 10 unsigned integer.
+func Uint64(v url.Values, key string) (uint64, *errs.PubError) {
+	s, perr := requiredParam(v, key)
+	if perr != nil {
+		return 0, perr
+	}
+	i, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, errs.PubErrorf("route parameter %q is not an unsigned integer", key)
+	}
+	return i, nil
+}
+
+func requiredParam(v url.Values, key string) (string, *errs.PubError) {
+	s := v.Get(key)
+	if s == "" {
+		return "", errs.PubErrorf("missing route parameter %q", key)
+	}
+	return s, nil
+}
@@ -0,0 +1,217 @@
+package route
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fwis/goweb/sweb/zip"
+)
+
+// CORSOptions is a Cross-Origin Resource Sharing policy.
+type CORSOptions struct {
+	// Origins allowed, like "https://example.com". "*" allows any origin,
+	// "https://*.example.com" any subdomain of example.com.
+	AllowedOrigins []string
+	// Methods allowed in preflights, GET, HEAD and POST if empty.
+	AllowedMethods []string
+	// Request headers allowed in preflights, "*" allows any.
+	// Accept, Accept-Language, Content-Language, Content-Type and
+	// X-Requested-With if empty.
+	AllowedHeaders []string
+	// Response headers the browser lets the page read.
+	ExposedHeaders []string
+	// Whether cookies and HTTP auth are sent, "*" origins are then echoed.
+	AllowCredentials bool
+	// How long preflight responses can be cached, not sent if 0.
+	MaxAge time.Duration
+}
+
+// corsPolicy is a CORSOptions ready to be checked against requests.
+type corsPolicy struct {
+	CORSOptions
+	anyOrigin  bool
+	anyHeader  bool
+	methods    string
+	headers    string
+	exposed    string
+	maxAge     string
+	wildcards  [][2]string // scheme://, .domain
+	originsSet map[string]bool
+}
+
+func newCORSPolicy(opts CORSOptions) *corsPolicy {
+	p := &corsPolicy{CORSOptions: opts, originsSet: make(map[string]bool)}
+	for _, origin := range opts.AllowedOrigins {
+		origin = strings.ToLower(origin)
+		if origin == "*" {
+			p.anyOrigin = true
+		} else if i := strings.Index(origin, "://*."); i >= 0 {
+			p.wildcards = append(p.wildcards, [2]string{origin[:i+3], origin[i+4:]})
+		} else {
+			p.originsSet[origin] = true
+		}
+	}
+	methods := append([]string(nil), opts.AllowedMethods...)
+	if len(methods) == 0 {
+		methods = []string{"GET", "HEAD", "POST"}
+	}
+	for k, m := range methods {
+		methods[k] = strings.ToUpper(m)
+	}
+	p.AllowedMethods = methods
+	p.methods = strings.Join(methods, ", ")
+	headers := append([]string(nil), opts.AllowedHeaders...)
+	if len(headers) == 0 {
+		headers = []string{"Accept", "Accept-Language", "Content-Language", "Content-Type", "X-Requested-With"}
+	}
+	for k, h := range headers {
+		if h == "*" {
+			p.anyHeader = true
+		}
+		headers[k] = http.CanonicalHeaderKey(h)
+	}
+	p.AllowedHeaders = headers
+	p.headers = strings.Join(headers, ", ")
+	p.exposed = strings.Join(opts.ExposedHeaders, ", ")
+	if opts.MaxAge > 0 {
+		p.maxAge = strconv.FormatInt(int64(opts.MaxAge/time.Second), 10)
+	}
+	return p
+}
+
+func (p *corsPolicy) originAllowed(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.originsSet[origin] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		if len(origin) > len(w[0])+len(w[1]) &&
+			strings.HasPrefix(origin, w[0]) && strings.HasSuffix(origin, w[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *corsPolicy) headersAllowed(requested string) bool {
+	if p.anyHeader || requested == "" {
+		return true
+	}
+	for _, h := range strings.Split(requested, ",") {
+		h = http.CanonicalHeaderKey(strings.TrimSpace(h))
+		if h != "" && !matchInArray(p.AllowedHeaders, h) {
+			return false
+		}
+	}
+	return true
+}
+
+// setAllowOrigin sets the headers common to preflights and actual requests.
+func (p *corsPolicy) setAllowOrigin(h http.Header, origin string) {
+	if p.anyOrigin && !p.AllowCredentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+	if p.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// handlePreflight answers a preflight request.
+func (p *corsPolicy) handlePreflight(w http.ResponseWriter, req *http.Request) {
+	h := w.Header()
+	zip.AddVary(h, "Origin")
+	zip.AddVary(h, "Access-Control-Request-Method")
+	zip.AddVary(h, "Access-Control-Request-Headers")
+
+	origin := req.Header.Get("Origin")
+	method := strings.ToUpper(req.Header.Get("Access-Control-Request-Method"))
+	requested := req.Header.Get("Access-Control-Request-Headers")
+	if p.originAllowed(origin) && matchInArray(p.AllowedMethods, method) && p.headersAllowed(requested) {
+		p.setAllowOrigin(h, origin)
+		h.Set("Access-Control-Allow-Methods", p.methods)
+		if p.anyHeader {
+			if requested != "" {
+				h.Set("Access-Control-Allow-Headers", requested)
+			}
+		} else {
+			h.Set("Access-Control-Allow-Headers", p.headers)
+		}
+		if p.maxAge != "" {
+			h.Set("Access-Control-Max-Age", p.maxAge)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleActual sets the CORS headers of an actual request.
+func (p *corsPolicy) handleActual(w http.ResponseWriter, req *http.Request) {
+	h := w.Header()
+	if !p.anyOrigin || p.AllowCredentials {
+		zip.AddVary(h, "Origin")
+	}
+	origin := req.Header.Get("Origin")
+	if origin == "" || !p.originAllowed(origin) {
+		return
+	}
+	p.setAllowOrigin(h, origin)
+	if p.exposed != "" {
+		h.Set("Access-Control-Expose-Headers", p.exposed)
+	}
+}
+
+// isPreflight reports whether the request is a CORS preflight.
+func isPreflight(req *http.Request) bool {
+	return req.Method == "OPTIONS" && req.Header.Get("Origin") != "" &&
+		req.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// CORS sets the CORS policy of the router, used by the routes outside of a
+// group with its own. Preflight requests for a route are answered
+// automatically, before the filters.
+func (r *Router) CORS(opts CORSOptions) {
+	r.cors = newCORSPolicy(opts)
+}
+
+// CORS sets the CORS policy of the group routes, and of its children
+// without their own.
+func (g *RouteGroup) CORS(opts CORSOptions) *RouteGroup {
+	g.cors = newCORSPolicy(opts)
+	return g
+}
+
+// corsPolicy returns the policy of the route, from its groups or router.
+func (r *RouteItem) corsPolicy() *corsPolicy {
+	for g := r.group; g != nil; g = g.parent {
+		if g.cors != nil {
+			return g.cors
+		}
+	}
+	return r.Router.cors
+}
+
+// servePreflight answers the request if it's a preflight for a route with a
+// CORS policy, and reports whether it did.
+func (r *Router) servePreflight(w http.ResponseWriter, req *http.Request) bool {
+	if !isPreflight(req) {
+		return false
+	}
+	actual := *req
+	actual.Method = strings.ToUpper(req.Header.Get("Access-Control-Request-Method"))
+	routeitem := r.Match(&actual)
+	if routeitem == nil {
+		return false
+	}
+	policy := routeitem.corsPolicy()
+	if policy == nil {
+		return false
+	}
+	policy.handlePreflight(w, req)
+	return true
+}
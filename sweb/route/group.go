@@ -0,0 +1,181 @@
+package route
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RouteGroup registers routes on a Router under a shared path prefix.
+//
+// Routes of a group inherit its OnlyScheme policy and EndSlashOption, and run
+// its filters after they are matched, so an /admin area can have its own
+// auth filter:
+//
+//     admin := r.Group("/admin")
+//     admin.Filter(authFilter)
+//     admin.VGET("/users", usersHandler)
+//
+// The routes are stored in the Router, in registration order with the others.
+type RouteGroup struct {
+	router *Router
+	parent *RouteGroup
+	// Full path prefix, including the parents'.
+	prefix         string
+	onlyscheme     string
+	endSlashOption EndSlashOption
+	filters        []Filter
+	middlewares    []Middleware
+	cors           *corsPolicy
+}
+
+// Group returns a group of routes under the path prefix.
+func (r *Router) Group(prefix string) *RouteGroup {
+	return &RouteGroup{router: r, prefix: strings.TrimRight(prefix, "/")}
+}
+
+// Group returns a child group, it inherits the prefix, the scheme policy,
+// the slash option and the filters of this group.
+func (g *RouteGroup) Group(prefix string) *RouteGroup {
+	return &RouteGroup{
+		router:         g.router,
+		parent:         g,
+		prefix:         g.prefix + strings.TrimRight(prefix, "/"),
+		onlyscheme:     g.onlyscheme,
+		endSlashOption: g.endSlashOption,
+	}
+}
+
+// OnlyScheme sets the scheme policy of the routes created afterwards,
+// see RouteItem.OnlyScheme.
+func (g *RouteGroup) OnlyScheme(scheme string) *RouteGroup {
+	g.onlyscheme = strings.ToLower(scheme)
+	return g
+}
+
+// SetSlashOption sets the slash option of the routes created afterwards.
+func (g *RouteGroup) SetSlashOption(option EndSlashOption) *RouteGroup {
+	g.endSlashOption = option
+	return g
+}
+
+// Prefix returns the full path prefix of the group.
+func (g *RouteGroup) Prefix() string {
+	return g.prefix
+}
+
+// NewRouteItem registers a route of the group. Its Path and PathPrefix
+// templates are relative to the group prefix.
+func (g *RouteGroup) NewRouteItem() *RouteItem {
+	routeitem := g.router.NewRouteItem()
+	routeitem.group = g
+	routeitem.pathPrefix = g.prefix
+	routeitem.endSlashOption = g.endSlashOption
+	routeitem.onlyscheme = g.onlyscheme
+	if g.prefix != "" {
+		routeitem.addMatcher(groupPrefixMatcher(g.prefix))
+	}
+	return routeitem
+}
+
+// groupPrefixMatcher matches the paths under a group prefix, even routes
+// without a path template stay in their group.
+type groupPrefixMatcher string
+
+func (m groupPrefixMatcher) Match(r *http.Request) bool {
+	p := r.URL.Path
+	return strings.HasPrefix(p, string(m)) &&
+		(len(p) == len(m) || p[len(m)] == '/')
+}
+
+func (g *RouteGroup) VGET(path string, handler VHandler) *RouteItem {
+	return g.NewRouteItem().Method("GET").Path(path).VHandler(handler)
+}
+
+func (g *RouteGroup) VGETfunc(path string, f func(http.ResponseWriter, *http.Request, url.Values)) *RouteItem {
+	return g.NewRouteItem().Method("GET").Path(path).VHandlerFunc(f)
+}
+
+func (g *RouteGroup) VPOST(path string, handler VHandler) *RouteItem {
+	return g.NewRouteItem().Method("POST").Path(path).VHandler(handler)
+}
+
+func (g *RouteGroup) VPOSTfunc(path string, f func(http.ResponseWriter, *http.Request, url.Values)) *RouteItem {
+	return g.NewRouteItem().Method("POST").Path(path).VHandlerFunc(f)
+}
+
+func (g *RouteGroup) VDELETE(path string, handler VHandler) *RouteItem {
+	return g.NewRouteItem().Method("DELETE").Path(path).VHandler(handler)
+}
+
+func (g *RouteGroup) VDELETEfunc(path string, f func(http.ResponseWriter, *http.Request, url.Values)) *RouteItem {
+	return g.NewRouteItem().Method("DELETE").Path(path).VHandlerFunc(f)
+}
+
+func (g *RouteGroup) VPUT(path string, handler VHandler) *RouteItem {
+	return g.NewRouteItem().Method("PUT").Path(path).VHandler(handler)
+}
+
+func (g *RouteGroup) VPUTfunc(path string, f func(http.ResponseWriter, *http.Request, url.Values)) *RouteItem {
+	return g.NewRouteItem().Method("PUT").Path(path).VHandlerFunc(f)
+}
+
+func (g *RouteGroup) VPATCH(path string, handler VHandler) *RouteItem {
+	return g.NewRouteItem().Method("PATCH").Path(path).VHandler(handler)
+}
+
+func (g *RouteGroup) VPATCHfunc(path string, f func(http.ResponseWriter, *http.Request, url.Values)) *RouteItem {
+	return g.NewRouteItem().Method("PATCH").Path(path).VHandlerFunc(f)
+}
+
+func (g *RouteGroup) VHEAD(path string, handler VHandler) *RouteItem {
+	return g.NewRouteItem().Method("HEAD").Path(path).VHandler(handler)
+}
+
+func (g *RouteGroup) VHEADfunc(path string, f func(http.ResponseWriter, *http.Request, url.Values)) *RouteItem {
+	return g.NewRouteItem().Method("HEAD").Path(path).VHandlerFunc(f)
+}
+
+func (g *RouteGroup) VOPTIONS(path string, handler VHandler) *RouteItem {
+	return g.NewRouteItem().Method("OPTIONS").Path(path).VHandler(handler)
+}
+
+func (g *RouteGroup) VOPTIONSfunc(path string, f func(http.ResponseWriter, *http.Request, url.Values)) *RouteItem {
+	return g.NewRouteItem().Method("OPTIONS").Path(path).VHandlerFunc(f)
+}
+
+// VMethods registers a handler for several methods at once.
+func (g *RouteGroup) VMethods(path string, handler VHandler, methods ...string) *RouteItem {
+	return g.NewRouteItem().Methods(methods...).Path(path).VHandler(handler)
+}
+
+func (g *RouteGroup) VHandle(path string, handler VHandler) *RouteItem {
+	return g.NewRouteItem().Path(path).VHandler(handler)
+}
+
+func (g *RouteGroup) HandleFunc(path string, f func(http.ResponseWriter, *http.Request, url.Values)) *RouteItem {
+	return g.NewRouteItem().Path(path).VHandlerFunc(f)
+}
+
+// Filter adds a filter run only for the routes of this group and its
+// children, after the Router filters.
+func (g *RouteGroup) Filter(filter Filter) {
+	g.filters = append(g.filters, filter)
+}
+
+func (g *RouteGroup) FilterFunc(f func(http.ResponseWriter, *http.Request) bool) {
+	g.Filter(FilterFunc(f))
+}
+
+// filterHTTP runs the filters of the parents, then of this group.
+func (g *RouteGroup) filterHTTP(w http.ResponseWriter, req *http.Request) bool {
+	if g.parent != nil && !g.parent.filterHTTP(w, req) {
+		return false
+	}
+	for _, filter := range g.filters {
+		if ok := filter.FilterHTTP(w, req); !ok {
+			return false
+		}
+	}
+	return true
+}
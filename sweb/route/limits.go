@@ -0,0 +1,175 @@
+package route
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	sctx "github.com/fwis/goweb/sweb/context"
+	"github.com/fwis/goweb/sweb/errs"
+)
+
+// Timeout limits the time the route handler may run. The request context is
+// canceled at the deadline and a 503 is replied through Router.ErrorHandle.
+//
+// The response is buffered until the handler returns, so streaming responses
+// and http.Flusher don't work on routes with a timeout. Writes after the
+// deadline fail with http.ErrHandlerTimeout. The handler runs in its own
+// goroutine, a panic in it is re-raised in the serving goroutine and Recovery
+// logs the stack of the handler goroutine.
+func (r *RouteItem) Timeout(d time.Duration) *RouteItem {
+	r.timeout = d
+	r.Router.invalidate()
+	return r
+}
+
+// MaxConcurrent limits the number of requests served at once by the route.
+// Requests over the limit are rejected right away with
+// Router.LoadShedStatus through Router.ErrorHandle. 0 means no limit.
+//
+// With a Timeout, a handler keeps its slot until it returns, even after the
+// timeout was replied. Call it before serving, the count restarts from 0.
+func (r *RouteItem) MaxConcurrent(n int) *RouteItem {
+	r.sem = nil
+	if n > 0 {
+		r.sem = make(chan struct{}, n)
+	}
+	r.Router.invalidate()
+	return r
+}
+
+// replyError replies status through the router ErrorHandle.
+func (r *Router) replyError(w http.ResponseWriter, req *http.Request, status int) {
+	errHandle := r.ErrorHandle
+	if errHandle == nil {
+		errHandle = errs.NewDefaultErrorHandle()
+	}
+	errHandle.Error(&sctx.Context{R: req, W: w}, status, http.StatusText(status))
+}
+
+// wrapLimits wraps the route handler with its concurrency limit and timeout.
+// The limit is inside the timeout, so it's taken and released by the handler
+// goroutine, which may run on after the timeout.
+func (r *RouteItem) wrapLimits(h VHandler) VHandler {
+	if r.sem != nil {
+		h = concurrencyVHandler(r.Router, h, r.sem)
+	}
+	if r.timeout > 0 {
+		h = timeoutVHandler(r.Router, h, r.timeout)
+	}
+	return h
+}
+
+func concurrencyVHandler(router *Router, h VHandler, sem chan struct{}) VHandler {
+	return VHandlerFunc(func(w http.ResponseWriter, req *http.Request, v url.Values) {
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+			h.VServeHTTP(w, req, v)
+		default:
+			status := router.LoadShedStatus
+			if status == 0 {
+				status = http.StatusServiceUnavailable
+			}
+			w.Header().Set("Retry-After", "1")
+			router.replyError(w, req, status)
+		}
+	})
+}
+
+// handlerPanic carries a panic out of the goroutine running a handler with a
+// timeout, with the stack of that goroutine. Recovery logs that stack instead
+// of the one of the serving goroutine.
+type handlerPanic struct {
+	value interface{}
+	stack []byte
+}
+
+func (p *handlerPanic) String() string {
+	return fmt.Sprintf("%v\n\nhandler goroutine stack:\n%s", p.value, p.stack)
+}
+
+func timeoutVHandler(router *Router, h VHandler, d time.Duration) VHandler {
+	return VHandlerFunc(func(w http.ResponseWriter, req *http.Request, v url.Values) {
+		ctx, cancel := context.WithTimeout(req.Context(), d)
+		defer cancel()
+		req = req.WithContext(ctx)
+
+		tw := &timeoutWriter{w: w, h: make(http.Header)}
+		done := make(chan struct{})
+		panicChan := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					if p != http.ErrAbortHandler {
+						p = &handlerPanic{value: p, stack: debug.Stack()}
+					}
+					panicChan <- p
+				}
+			}()
+			h.VServeHTTP(tw, req, v)
+			close(done)
+		}()
+
+		select {
+		case p := <-panicChan:
+			panic(p)
+		case <-done:
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			dst := w.Header()
+			for k, vv := range tw.h {
+				dst[k] = vv
+			}
+			if tw.code == 0 {
+				tw.code = http.StatusOK
+			}
+			w.WriteHeader(tw.code)
+			w.Write(tw.wbuf.Bytes())
+		case <-ctx.Done():
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			tw.timedOut = true
+			router.replyError(w, req, http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// timeoutWriter buffers the response of a handler running with a timeout.
+type timeoutWriter struct {
+	w    http.ResponseWriter
+	h    http.Header
+	wbuf bytes.Buffer
+
+	mu       sync.Mutex
+	timedOut bool
+	code     int
+}
+
+func (tw *timeoutWriter) Header() http.Header { return tw.h }
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.code == 0 {
+		tw.code = http.StatusOK
+	}
+	return tw.wbuf.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.code != 0 {
+		return
+	}
+	tw.code = code
+}
@@ -0,0 +1,49 @@
+package route
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestMaxConcurrentWithTimeout checks handlers past their timeout still count
+// against MaxConcurrent.
+func TestMaxConcurrentWithTimeout(t *testing.T) {
+	var running, maxRunning int32
+	slow := func(w http.ResponseWriter, req *http.Request, v url.Values) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	r := NewRouter()
+	r.VGETfunc("/slow", slow).MaxConcurrent(1).Timeout(20 * time.Millisecond)
+
+	statuses := map[int]int{}
+	for i := 0; i < 10; i++ {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", "/slow", nil))
+		statuses[rec.Code]++
+		// Rebuilding the tree must not reset the count either.
+		r.invalidate()
+	}
+	for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&running) > 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if n := atomic.LoadInt32(&maxRunning); n != 1 {
+		t.Errorf("%d handlers ran at once, want 1", n)
+	}
+	if statuses[http.StatusServiceUnavailable] != 10 {
+		t.Errorf("statuses %v, want 10 x 503", statuses)
+	}
+}
@@ -0,0 +1,27 @@
+package route
+
+import (
+	"net/http"
+
+	"github.com/fwis/goweb/sweb/logs"
+)
+
+var logVar logs.Var
+
+func logger() logs.Logger { return logVar.Get() }
+
+func init() {
+	// Adds the matched route to the logs of a request.
+	logs.RegisterRequestFields(func(r *http.Request) []interface{} {
+		if item := CurrentRoute(r); item != nil && item.GetPathTemplate() != "" {
+			return []interface{}{"route", item.GetPathTemplate()}
+		}
+		return nil
+	})
+}
+
+// SetLogger sets the logger of the mux errors and warnings, like a recovered
+// panic. logs.Discard silences them.
+func SetLogger(l logs.Logger) {
+	logVar.Set(l)
+}
@@ -0,0 +1,76 @@
+package route
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// Middleware wraps a VHandler, it can run code before and after the handler,
+// or not call it at all.
+//
+// Middlewares are composed in this order, the first one being the outermost:
+//
+//  1. Router.Use, around the whole request, including the Router filters,
+//     redirects and the NotFound and MethodNotAllowed handlers;
+//  2. RouteGroup.Use, the parent groups first, once a route has matched and
+//     the group filters have passed;
+//  3. RouteItem.MaxConcurrent, then RouteItem.Timeout, if set;
+//  4. RouteItem.Use, around the route handler.
+//
+// Within a Use call, and across calls, middlewares added first run first.
+// The Router.Recover middleware, if any, runs before all of them.
+type Middleware func(VHandler) VHandler
+
+// FilterMiddleware adapts a Filter into a Middleware, the next handler is
+// only called if the filter returns true.
+func FilterMiddleware(filter Filter) Middleware {
+	return func(next VHandler) VHandler {
+		return VHandlerFunc(func(w http.ResponseWriter, r *http.Request, v url.Values) {
+			if filter.FilterHTTP(w, r) {
+				next.VServeHTTP(w, r, v)
+			}
+		})
+	}
+}
+
+// Use adds middlewares around every request served by the router.
+func (r *Router) Use(mws ...Middleware) {
+	r.middlewares = append(r.middlewares, mws...)
+	r.invalidate()
+}
+
+// Use adds middlewares around the handlers of the group routes.
+func (g *RouteGroup) Use(mws ...Middleware) *RouteGroup {
+	g.middlewares = append(g.middlewares, mws...)
+	g.router.invalidate()
+	return g
+}
+
+// Use adds middlewares around the route handler.
+func (r *RouteItem) Use(mws ...Middleware) *RouteItem {
+	r.middlewares = append(r.middlewares, mws...)
+	r.Router.invalidate()
+	return r
+}
+
+// chainHandler returns the route handler wrapped by the route middlewares,
+// then by the middlewares of its groups.
+func (r *RouteItem) chainHandler() VHandler {
+	if r.handler == nil {
+		return nil
+	}
+	h := wrapMiddlewares(r.handler, r.middlewares)
+	h = r.wrapLimits(h)
+	for g := r.group; g != nil; g = g.parent {
+		h = wrapMiddlewares(h, g.middlewares)
+	}
+	return h
+}
+
+// wrapMiddlewares wraps h so that mws[0] is the outermost middleware.
+func wrapMiddlewares(h VHandler, mws []Middleware) VHandler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
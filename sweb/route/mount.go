@@ -0,0 +1,109 @@
+package route
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Mount sets h as the handler of the route, with the part of the path
+// matched by the route template stripped from the request URL:
+//
+//     r.NewRouteItem().PathPrefix("/debug/pprof").Mount(pprofMux)
+//
+// A request for /debug/pprof/heap reaches h as /heap. URL.RawPath is
+// stripped the same way, or cleared if it can't be.
+//
+// The prefix is only stripped at a segment boundary, so the route above
+// doesn't match /debug/pprofx.
+func (r *RouteItem) Mount(h http.Handler) *RouteItem {
+	r.addMatcher(&mountMatcher{r})
+	return r.VHandlerFunc(func(w http.ResponseWriter, req *http.Request, v url.Values) {
+		if r.regexp == nil || r.regexp.path == nil {
+			h.ServeHTTP(w, req)
+			return
+		}
+		end := r.mountPrefixLen(req.URL.Path)
+		if end < 0 {
+			http.NotFound(w, req)
+			return
+		}
+		h.ServeHTTP(w, stripPathPrefix(req, end))
+	})
+}
+
+// mountPrefixLen returns the length of the path prefix matched by the route
+// template, -1 if it doesn't match or doesn't end at a segment boundary:
+// the prefix ends with '/', or the rest of the path is empty or starts
+// with '/'.
+func (r *RouteItem) mountPrefixLen(path string) int {
+	loc := r.regexp.path.regexp.FindStringIndex(path)
+	if loc == nil {
+		return -1
+	}
+	end := loc[1]
+	if end == len(path) || path[end] == '/' || (end > 0 && path[end-1] == '/') {
+		return end
+	}
+	return -1
+}
+
+// mountMatcher rejects the paths a mounted route can't strip.
+type mountMatcher struct {
+	item *RouteItem
+}
+
+func (m *mountMatcher) Match(req *http.Request) bool {
+	r := m.item
+	if r.regexp == nil || r.regexp.path == nil {
+		return true
+	}
+	return r.mountPrefixLen(req.URL.Path) >= 0
+}
+
+// stripPathPrefix returns a shallow copy of the request, with the first n
+// bytes of the path removed.
+func stripPathPrefix(req *http.Request, n int) *http.Request {
+	r2 := new(http.Request)
+	*r2 = *req
+	r2.URL = new(url.URL)
+	*r2.URL = *req.URL
+
+	path, raw := req.URL.Path[n:], ""
+	if i := rawPrefixLen(req.URL.RawPath, n); i >= 0 {
+		raw = req.URL.RawPath[i:]
+	}
+	if !strings.HasPrefix(path, "/") {
+		path, raw = "/"+path, "/"+raw
+	}
+	r2.URL.Path = path
+	r2.URL.RawPath = ""
+	// Keep RawPath only if it's still the encoding of Path.
+	if p, err := url.PathUnescape(raw); err == nil && p == path && raw != path {
+		r2.URL.RawPath = raw
+	}
+	return r2
+}
+
+// rawPrefixLen returns the length of the escaped path prefix decoding to n
+// bytes, or -1.
+func rawPrefixLen(raw string, n int) int {
+	if raw == "" {
+		return -1
+	}
+	i := 0
+	for decoded := 0; decoded < n; decoded++ {
+		if i >= len(raw) {
+			return -1
+		}
+		if raw[i] == '%' {
+			i += 3
+		} else {
+			i++
+		}
+	}
+	if i > len(raw) {
+		return -1
+	}
+	return i
+}
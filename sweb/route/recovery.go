@@ -0,0 +1,65 @@
+package route
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+
+	"github.com/fwis/goweb/sweb/context"
+	"github.com/fwis/goweb/sweb/errs"
+	"github.com/fwis/goweb/sweb/logs"
+)
+
+// PanicLogger logs the panics recovered by Recovery, *log.Logger is one.
+type PanicLogger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Recovery returns a Middleware recovering from panics in the next handler.
+// The panic and its stack are logged, through the package logger if
+// panicLogger is nil, then a 500 is replied through errHandle, the default
+// ErrorHandle if nil. Use errs.NewNegotiatedErrorHandle with the JSON and
+// HTML renderers to reply like them.
+//
+// http.ErrAbortHandler is not recovered, net/http uses it to abort a response.
+func Recovery(errHandle errs.ErrorHandle, panicLogger PanicLogger) Middleware {
+	if errHandle == nil {
+		errHandle = errs.NewDefaultErrorHandle()
+	}
+	return func(next VHandler) VHandler {
+		return VHandlerFunc(func(w http.ResponseWriter, req *http.Request, v url.Values) {
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				stack := debug.Stack()
+				if hp, ok := p.(*handlerPanic); ok {
+					p, stack = hp.value, hp.stack
+				}
+				if panicLogger != nil {
+					panicLogger.Printf("route: panic serving %s %s: %v\n%s", req.Method, req.URL, p, stack)
+				} else {
+					logs.ForRequest(logger(), req).Errorf("route: panic serving %s %s: %v\n%s", req.Method, req.URL, p, stack)
+				}
+				err, ok := p.(error)
+				if !ok {
+					err = fmt.Errorf("%v", p)
+				}
+				errHandle.Errorv(&context.Context{R: req, W: w}, http.StatusInternalServerError, err)
+			}()
+			next.VServeHTTP(w, req, v)
+		})
+	}
+}
+
+// Recover enables panic recovery for every request, outside of all the
+// middlewares added with Use. See Recovery.
+func (r *Router) Recover(errHandle errs.ErrorHandle, panicLogger PanicLogger) {
+	r.recovery = Recovery(errHandle, panicLogger)
+	r.invalidate()
+}
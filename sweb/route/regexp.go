@@ -7,12 +7,16 @@ package route
 import (
 	"bytes"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
 )
 
+// defaultPathPattern is the pattern of a path variable without one.
+const defaultPathPattern = "[^/]+"
+
 // newRouteRegexp parses a route template and returns a routeRegexp,
 // used to match a host or path.
 //
@@ -23,7 +27,7 @@ import (
 // Previously we accepted only Python-like identifiers for variable
 // names ([a-zA-Z_][a-zA-Z0-9_]*), but currently the only restriction is that
 // name and pattern can't be empty, and names can't contain a colon.
-func newRouteRegexp(tpl string, matchPrefix, fuzzyMatchSlash bool) (*routeRegexp, error) {
+func newRouteRegexp(tpl string, matchHost, matchPrefix, fuzzyMatchSlash bool) (*routeRegexp, error) {
 	// Check if it is well-formed.
 	idxs, errBraces := braceIndices(tpl)
 	if errBraces != nil {
@@ -32,11 +36,11 @@ func newRouteRegexp(tpl string, matchPrefix, fuzzyMatchSlash bool) (*routeRegexp
 	// Backup the original.
 	template := tpl
 	// Now let's parse it.
-	defaultPattern := "[^/]+"
-	// if matchHost {
-	// 	defaultPattern = "[^.]+"
-	// 	matchPrefix, fuzzyMatchSlash = false, false
-	// }
+	defaultPattern := defaultPathPattern
+	if matchHost {
+		defaultPattern = "[^.]+"
+		matchPrefix, fuzzyMatchSlash = false, false
+	}
 	if matchPrefix {
 		fuzzyMatchSlash = false
 	}
@@ -50,17 +54,24 @@ func newRouteRegexp(tpl string, matchPrefix, fuzzyMatchSlash bool) (*routeRegexp
 	varsR := make([]*regexp.Regexp, len(idxs)/2)
 	pattern := bytes.NewBufferString("^")
 	reverse := bytes.NewBufferString("")
+	// Template without the variables.
+	raws := bytes.NewBufferString("")
 	var end int
 	var err error
 	for i := 0; i < len(idxs); i += 2 {
 		// Set all values we are interested in.
 		raw := tpl[end:idxs[i]]
+		raws.WriteString(raw)
 		end = idxs[i+1]
 		parts := strings.SplitN(tpl[idxs[i]+1:end-1], ":", 2)
 		name := parts[0]
 		patt := defaultPattern
 		if len(parts) == 2 {
 			patt = parts[1]
+			// A converter name stands for its pattern.
+			if c, ok := lookupConverter(patt); ok {
+				patt = c.Pattern
+			}
 		}
 		// Name or pattern can't be empty.
 		if name == "" || patt == "" {
@@ -80,6 +91,7 @@ func newRouteRegexp(tpl string, matchPrefix, fuzzyMatchSlash bool) (*routeRegexp
 	}
 	// Add the remaining.
 	raw := tpl[end:]
+	raws.WriteString(raw)
 	pattern.WriteString(regexp.QuoteMeta(raw))
 	if fuzzyMatchSlash {
 		pattern.WriteString("[/]?")
@@ -98,12 +110,15 @@ func newRouteRegexp(tpl string, matchPrefix, fuzzyMatchSlash bool) (*routeRegexp
 	}
 	// Done!
 	return &routeRegexp{
-		template:  template,
-		// matchHost: matchHost,
-		regexp:    reg,
-		reverse:   reverse.String(),
-		varsN:     varsN,
-		varsR:     varsR,
+		template:    template,
+		matchHost:   matchHost,
+		withPort:    matchHost && strings.Contains(raws.String(), ":"),
+		matchPrefix: matchPrefix,
+		fuzzySlash:  fuzzyMatchSlash,
+		regexp:      reg,
+		reverse:     reverse.String(),
+		varsN:       varsN,
+		varsR:       varsR,
 	}, nil
 }
 
@@ -113,7 +128,13 @@ type routeRegexp struct {
 	// The unmodified template.
 	template string
 	// True for host match, false for path match.
-	// matchHost bool
+	matchHost bool
+	// True if the host template has a port.
+	withPort bool
+	// True for a path prefix match.
+	matchPrefix bool
+	// True if the trailing slash is optional.
+	fuzzySlash bool
 	// Expanded regexp.
 	regexp *regexp.Regexp
 	// Reverse template.
@@ -126,18 +147,24 @@ type routeRegexp struct {
 
 // Match matches the regexp against the URL host or path.
 func (r *routeRegexp) Match(req *http.Request) bool {
-	// if !r.matchHost {
-	return r.regexp.MatchString(req.URL.Path)
-	// }
-    /*
-	host := getHost(req)
-	//fmt.Printf("@@@@@@@ matchhost, template=%v, host=%v\n", r.template, host)
+	if !r.matchHost {
+		return r.regexp.MatchString(req.URL.Path)
+	}
+	host := r.getHost(req)
 	if r.template == host {
 		return true
 	} else {
 		return r.regexp.MatchString(host)
 	}
-    */
+}
+
+// getHost returns the request host to match, with the port only if the
+// template has one.
+func (r *routeRegexp) getHost(req *http.Request) string {
+	if r.withPort {
+		return getHostPort(req)
+	}
+	return getHost(req)
 }
 
 // url builds a URL part using the given values.
@@ -166,6 +193,7 @@ func (r *routeRegexp) url(pairs ...string) (string, error) {
 					r.varsR[k].String())
 			}
 		}
+		return "", fmt.Errorf("mux: url %q doesn't match the template %q", rv, r.template)
 	}
 	return rv, nil
 }
@@ -201,24 +229,21 @@ func braceIndices(s string) ([]int, error) {
 
 // routeRegexpGroup groups the route matchers that carry variables.
 type routeRegexpGroup struct {
-	// host *routeRegexp
+	host *routeRegexp
 	path *routeRegexp
 }
 
 // setMatch extracts the variables from the URL once a route matches.
 func (v *routeRegexpGroup) fillURLParamters(req *http.Request, routeParams url.Values) {
 	// Store host variables.
-    /*
 	if v.host != nil {
-		hostVars := v.host.regexp.FindStringSubmatch(getHost(req))
+		hostVars := v.host.regexp.FindStringSubmatch(v.host.getHost(req))
 		if hostVars != nil {
 			for k, v := range v.host.varsN {
-                routeParams.Add(v,hostVars[k+1])
-				//routeParams[v] = hostVars[k+1]
+				routeParams.Add(v, hostVars[k+1])
 			}
 		}
 	}
-    */
 	// Store path variables.
 	if v.path != nil {
 		pathVars := v.path.regexp.FindStringSubmatch(req.URL.Path)
@@ -231,15 +256,20 @@ func (v *routeRegexpGroup) fillURLParamters(req *http.Request, routeParams url.V
 	}
 }
 
-// getHost tries its best to return the request host.
+// getHost tries its best to return the request host, without the port.
 func getHost(r *http.Request) string {
-	if !r.URL.IsAbs() {
-		host := r.Host
-		// Slice off any port information.
-		if i := strings.Index(host, ":"); i != -1 {
-			host = host[:i]
-		}
-		return host
+	host := getHostPort(r)
+	// Slice off any port information, IPv6 literals keep their colons.
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
+
+// getHostPort returns the request host, with the port if there is one.
+func getHostPort(r *http.Request) string {
+	if r.URL.IsAbs() {
+		return r.URL.Host
 	}
-	return r.URL.Host
+	return r.Host
 }
@@ -9,6 +9,7 @@ import (
 	"net/http"
     "net/url"
 	"strings"
+	"time"
 )
 
 //type RouteParams map[string]string
@@ -70,6 +71,22 @@ type RouteItem struct {
 	// Error resulted from building a route.
 	err error
 
+	// Name used to build URLs.
+	name string
+
+	// Group the route was registered with, if any.
+	group *RouteGroup
+	// Prepended to the path template.
+	pathPrefix string
+
+	// Wrap the handler, see Middleware.
+	middlewares []Middleware
+
+	// Limits of the handler, 0 and nil for none. The semaphore lives with the
+	// route, not with its compiled handler, so a tree rebuild keeps the count.
+	timeout time.Duration
+	sem     chan struct{}
+
 	// OnlyScheme=http,  https will force redirect to http
 	// OnlyScheme=https, http will force redirect to https
 	// otherwise, ignore
@@ -91,6 +108,46 @@ func (r *RouteItem) Match(req *http.Request) bool {
 	return true
 }
 
+// matchSkipping is Match without the given matcher, used when the route tree
+// already matched the path.
+func (r *RouteItem) matchSkipping(req *http.Request, skip matcher) bool {
+	if r.err != nil {
+		return false
+	}
+	for _, m := range r.matchers {
+		if m == skip {
+			continue
+		}
+		if matched := m.Match(req); !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchIgnoringMethods is matchSkipping without the method matchers, to tell
+// a wrong method from a route not matching at all.
+func (r *RouteItem) matchIgnoringMethods(req *http.Request, skip matcher) bool {
+	if r.err != nil {
+		return false
+	}
+	for _, m := range r.matchers {
+		switch m.(type) {
+		case methodMatcher, methodsMatcher:
+			continue
+		}
+		if m == skip {
+			continue
+		}
+		if matched := m.Match(req); !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
 // ----------------------------------------------------------------------------
 // RouteItem attributes
 // ----------------------------------------------------------------------------
@@ -100,17 +157,20 @@ func (r *RouteItem) GetError() error {
 	return r.err
 }
 
+// GetSchemeRedirectURL returns the URL to redirect to if the request scheme
+// isn't the OnlyScheme of the route, "" otherwise. The scheme is read with
+// Router.RequestScheme, the target host is the httphost or httpshost of the
+// router, see NewRouterWithHost. If not set, it's the request host without its
+// port, the target scheme being on its default port; set them to redirect to
+// other ports.
 func (r *RouteItem) GetSchemeRedirectURL(req *http.Request) string {
-	var is_https_req bool = (req.TLS != nil)
-	if "https" == req.Header.Get("X-Scheme") {
-		is_https_req = true
-	}
+	var is_https_req bool = r.Router.RequestScheme(req) == "https"
 
 	var redirectURL string = ""
 	if r.onlyscheme == "http" && is_https_req {
-		redirectURL = r.Router.httphost + req.RequestURI
+		redirectURL = schemeRedirectURL(req, "http", r.Router.httphost)
 	} else if r.onlyscheme == "https" && !is_https_req && r.Router.enable_to_https {
-		redirectURL = r.Router.httpshost + req.RequestURI
+		redirectURL = schemeRedirectURL(req, "https", r.Router.httpshost)
 	} else {
 		redirectURL = ""
 	}
@@ -125,12 +185,82 @@ func (r *RouteItem) GetSlashOption() EndSlashOption {
 	return r.endSlashOption
 }
 
+// Name -----------------------------------------------------------------------
+
+// Name sets the name for the route, used to build URLs.
+// A later route registered with the same name replaces this one.
+func (r *RouteItem) Name(name string) *RouteItem {
+	if r.name != "" {
+		r.err = fmt.Errorf("mux: route already has name %q, can't set %q",
+			r.name, name)
+	}
+	if r.err == nil {
+		r.name = name
+		if r.Router.namedItems == nil {
+			r.Router.namedItems = make(map[string]*RouteItem)
+		}
+		r.Router.namedItems[name] = r
+	}
+	return r
+}
+
+// GetName returns the name for the route, if any.
+func (r *RouteItem) GetName() string {
+	return r.name
+}
+
+// URL builds a URL for the route.
+//
+// It accepts a sequence of key/value pairs for the route variables. For
+// example, given this route:
+//
+//     r := route.NewRouter()
+//     r.VGET("/articles/{category}/{id:[0-9]+}", handler).
+//       Name("article")
+//
+// ...a URL for it can be built using:
+//
+//     url, err := r.Get("article").URL("category", "technology", "id", "42")
+//
+// ...which will return an url.URL with the following path:
+//
+//     "/articles/technology/42"
+//
+// A missing variable, or a value not matching the variable pattern, is
+// reported as an error.
+func (r *RouteItem) URL(pairs ...string) (*url.URL, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.regexp == nil || r.regexp.path == nil {
+		return nil, fmt.Errorf("mux: route %q doesn't have a path", r.name)
+	}
+	path, err := r.regexp.path.url(pairs...)
+	if err != nil {
+		return nil, err
+	}
+	u := &url.URL{Path: path}
+	if r.regexp.host != nil {
+		host, err := r.regexp.host.url(pairs...)
+		if err != nil {
+			return nil, err
+		}
+		u.Scheme = "http"
+		if r.onlyscheme == "https" {
+			u.Scheme = "https"
+		}
+		u.Host = host
+	}
+	return u, nil
+}
+
 // Handler --------------------------------------------------------------------
 
 // Handler sets a handler for the route.
 func (r *RouteItem) VHandler(handler VHandler) *RouteItem {
 	if r.err == nil {
 		r.handler = handler
+		r.Router.invalidate()
 	}
 	return r
 }
@@ -163,9 +293,13 @@ func (r *RouteItem) addMatcher(m matcher) *RouteItem {
 }
 
 func (r *RouteItem) GetRouteParams(req *http.Request) url.Values {
-    if r.regexp == nil || r.regexp.path == nil || len(r.regexp.path.varsN)==0{
-        return nil
-    }
+	if r.regexp == nil {
+		return nil
+	}
+	if (r.regexp.path == nil || len(r.regexp.path.varsN) == 0) &&
+		(r.regexp.host == nil || len(r.regexp.host.varsN) == 0) {
+		return nil
+	}
 
     s := make(url.Values)
 	//routeParams := make(RouteParams)
@@ -187,25 +321,26 @@ func (r *RouteItem) EndWithSlash() int {
 }
 
 // addRegexpMatcher adds a host or path matcher and builder to a route.
-func (r *RouteItem) addRegexpMatcher(tpl string, matchPrefix bool) error {
+func (r *RouteItem) addRegexpMatcher(tpl string, matchHost, matchPrefix bool) error {
 	if r.err != nil {
 		return r.err
 	}
 	r.regexp = r.getRegexpGroup()
-	// if !matchHost {
+	if !matchHost {
 		if len(tpl) == 0 || tpl[0] != '/' {
 			return fmt.Errorf("mux: path must start with a slash, got %q", tpl)
 		}
 		if r.regexp.path != nil {
 			tpl = strings.TrimRight(r.regexp.path.template, "/") + tpl
+		} else {
+			tpl = r.pathPrefix + tpl
 		}
-	// }
+	}
 
-	rr, err := newRouteRegexp(tpl, matchPrefix, r.endSlashOption != END_SLASH_EXACT)
+	rr, err := newRouteRegexp(tpl, matchHost, matchPrefix, r.endSlashOption != END_SLASH_EXACT)
 	if err != nil {
 		return err
 	}
-    /*
 	if matchHost {
 		if r.regexp.path != nil {
 			if err = uniqueVars(rr.varsN, r.regexp.path.varsN); err != nil {
@@ -214,18 +349,15 @@ func (r *RouteItem) addRegexpMatcher(tpl string, matchPrefix bool) error {
 		}
 		r.regexp.host = rr
 	} else {
-    
 		if r.regexp.host != nil {
 			if err = uniqueVars(rr.varsN, r.regexp.host.varsN); err != nil {
 				return err
 			}
 		}
-        
 		r.regexp.path = rr
 	}
-    */
-    r.regexp.path = rr
 	r.addMatcher(rr)
+	r.Router.invalidate()
 	return nil
 }
 
@@ -274,12 +406,14 @@ func (r *RouteItem) Headers(pairs ...string) *RouteItem {
 //     r.Host("{subdomain}.domain.com")
 //     r.Host("{subdomain:[a-z]+}.domain.com")
 //
-// Variable names must be unique in a given route. They can be retrieved
-// calling mux.Vars(request).
-// func (r *RouteItem) Host(tpl string) *RouteItem {
-// 	r.err = r.addRegexpMatcher(tpl, true, false)
-// 	return r
-// }
+// A template without a port matches any port of the request host.
+//
+// Variable names must be unique in a given route, host variables are merged
+// with the path variables passed to the VHandler.
+func (r *RouteItem) Host(tpl string) *RouteItem {
+	r.err = r.addRegexpMatcher(tpl, true, false)
+	return r
+}
 
 // MatcherFunc ----------------------------------------------------------------
 
@@ -307,6 +441,20 @@ func (r *RouteItem) Method(method string) *RouteItem {
 	return r.addMatcher(methodMatcher(strings.ToUpper(method)))
 }
 
+// methods returns the methods the route is restricted to, nil for any.
+func (r *RouteItem) methods() []string {
+	var methods []string
+	for _, m := range r.matchers {
+		switch m := m.(type) {
+		case methodMatcher:
+			methods = append(methods, string(m))
+		case methodsMatcher:
+			methods = append(methods, m...)
+		}
+	}
+	return methods
+}
+
 // methodsMatcher matches the request against HTTP methods.
 type methodsMatcher []string
 
@@ -317,11 +465,12 @@ func (m methodsMatcher) Match(r *http.Request) bool {
 // Methods adds a matcher for HTTP methods.
 // It accepts a sequence of one or more methods to be matched, e.g.:
 // "GET", "POST", "PUT".
-func (r *RouteItem) _methods(methods ...string) *RouteItem {
+func (r *RouteItem) Methods(methods ...string) *RouteItem {
+	upper := make(methodsMatcher, len(methods))
 	for k, v := range methods {
-		methods[k] = strings.ToUpper(v)
+		upper[k] = strings.ToUpper(v)
 	}
-	return r.addMatcher(methodsMatcher(methods))
+	return r.addMatcher(upper)
 }
 
 // Path -----------------------------------------------------------------------
@@ -334,6 +483,9 @@ func (r *RouteItem) _methods(methods ...string) *RouteItem {
 //
 // - {name:pattern} matches the given regexp pattern.
 //
+// - {name:type} matches the pattern of a Converter: int, uint, slug, uuid
+// or one added with RegisterConverter.
+//
 // For example:
 //
 //     r := mux.NewRouter()
@@ -345,7 +497,7 @@ func (r *RouteItem) _methods(methods ...string) *RouteItem {
 // Variable names must be unique in a given route. They can be retrieved
 // calling mux.Vars(request).
 func (r *RouteItem) Path(tpl string) *RouteItem {
-	r.err = r.addRegexpMatcher(tpl, false)
+	r.err = r.addRegexpMatcher(tpl, false, false)
 	return r
 }
 
@@ -354,7 +506,7 @@ func (r *RouteItem) Path(tpl string) *RouteItem {
 // PathPrefix adds a matcher for the URL path prefix.
 func (r *RouteItem) PathPrefix(tpl string) *RouteItem {
 	r.endSlashOption = END_SLASH_EXACT
-	r.err = r.addRegexpMatcher(tpl, true)
+	r.err = r.addRegexpMatcher(tpl, false, true)
 	return r
 }
 
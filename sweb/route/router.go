@@ -1,9 +1,17 @@
 package route
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+
+	"github.com/fwis/goweb/sweb/errs"
 )
 
 type FilterFunc func(http.ResponseWriter, *http.Request) bool
@@ -19,13 +27,40 @@ type Filter interface {
 type Router struct {
 	// Configurable Handler to be used when no route matches.
 	NotFoundVHandler VHandler
+	// Configurable Handler to be used when a route matches, except for the
+	// method. The Allow header is already set when it's called.
+	MethodNotAllowedVHandler VHandler
+	// Replies the errors of the router itself, like timeouts.
+	// The default ErrorHandle if nil.
+	ErrorHandle errs.ErrorHandle
+	// Status replied by routes over their MaxConcurrent, 503 if 0.
+	LoadShedStatus int
 	//first filters, then items
 	filters []Filter
+	// Wrap every request, see Middleware.
+	middlewares []Middleware
+	// Outermost middleware, set by Recover.
+	recovery Middleware
 	// Routes to be matched, in order.
-	items           []*RouteItem
+	items []*RouteItem
+	// Routes by name, to build URLs.
+	namedItems      map[string]*RouteItem
 	httphost        string
 	httpshost       string
 	enable_to_https bool //是否允许重定向到 https
+	// Proxies trusted to tell the request scheme.
+	trustedProxies TrustedProxies
+	// Status of the OnlyScheme redirects, 303 if 0.
+	schemeRedirectStatus int
+	// Logs once the scheme headers ignored without trusted proxies.
+	schemeWarnOnce sync.Once
+	// Strict-Transport-Security header value, "" if disabled.
+	hsts string
+	// CORS policy of the routes outside of groups with their own.
+	cors *corsPolicy
+	// Radix tree compiled from items, nil until the next Match.
+	tree     *routeTree
+	treeLock sync.RWMutex
 }
 
 // NewRouter returns a new router instance.
@@ -49,9 +84,44 @@ func NewRouterWithHost(httphost, httpshost string, enable_to_https bool) *Router
 func (r *Router) NewRouteItem() *RouteItem {
 	routeitem := &RouteItem{Router: r}
 	r.items = append(r.items, routeitem)
+	r.invalidate()
 	return routeitem
 }
 
+// Get returns the route registered with the given name, or nil.
+func (r *Router) Get(name string) *RouteItem {
+	return r.namedItems[name]
+}
+
+// URLFor builds the path of the named route, the pairs are the route
+// variables as key/value. Values are formatted with fmt.Sprint, so it can be
+// used in templates:
+//
+//     {{urlfor "user.show" "id" .ID}}
+func (r *Router) URLFor(name string, pairs ...interface{}) (string, error) {
+	routeitem := r.Get(name)
+	if routeitem == nil {
+		return "", fmt.Errorf("mux: route %q not found", name)
+	}
+	spairs := make([]string, len(pairs))
+	for k, v := range pairs {
+		spairs[k] = fmt.Sprint(v)
+	}
+	u, err := routeitem.URL(spairs...)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// TemplateFuncs returns the template helpers bound to this router, to be
+// passed as the FuncMap of a HTMLRenderEngine.
+func (r *Router) TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"urlfor": r.URLFor,
+	}
+}
+
 func (r *Router) VGET(path string, handler VHandler) *RouteItem {
 	return r.NewRouteItem().Method("GET").Path(path).VHandler(handler)
 }
@@ -76,6 +146,43 @@ func (r *Router) VDELETEfunc(path string, f func(http.ResponseWriter, *http.Requ
 	return r.NewRouteItem().Method("DELETE").Path(path).VHandlerFunc(f)
 }
 
+func (r *Router) VPUT(path string, handler VHandler) *RouteItem {
+	return r.NewRouteItem().Method("PUT").Path(path).VHandler(handler)
+}
+
+func (r *Router) VPUTfunc(path string, f func(http.ResponseWriter, *http.Request, url.Values)) *RouteItem {
+	return r.NewRouteItem().Method("PUT").Path(path).VHandlerFunc(f)
+}
+
+func (r *Router) VPATCH(path string, handler VHandler) *RouteItem {
+	return r.NewRouteItem().Method("PATCH").Path(path).VHandler(handler)
+}
+
+func (r *Router) VPATCHfunc(path string, f func(http.ResponseWriter, *http.Request, url.Values)) *RouteItem {
+	return r.NewRouteItem().Method("PATCH").Path(path).VHandlerFunc(f)
+}
+
+func (r *Router) VHEAD(path string, handler VHandler) *RouteItem {
+	return r.NewRouteItem().Method("HEAD").Path(path).VHandler(handler)
+}
+
+func (r *Router) VHEADfunc(path string, f func(http.ResponseWriter, *http.Request, url.Values)) *RouteItem {
+	return r.NewRouteItem().Method("HEAD").Path(path).VHandlerFunc(f)
+}
+
+func (r *Router) VOPTIONS(path string, handler VHandler) *RouteItem {
+	return r.NewRouteItem().Method("OPTIONS").Path(path).VHandler(handler)
+}
+
+func (r *Router) VOPTIONSfunc(path string, f func(http.ResponseWriter, *http.Request, url.Values)) *RouteItem {
+	return r.NewRouteItem().Method("OPTIONS").Path(path).VHandlerFunc(f)
+}
+
+// VMethods registers a handler for several methods at once.
+func (r *Router) VMethods(path string, handler VHandler, methods ...string) *RouteItem {
+	return r.NewRouteItem().Methods(methods...).Path(path).VHandler(handler)
+}
+
 func (r *Router) VHandle(path string, handler VHandler) *RouteItem {
 	return r.NewRouteItem().Path(path).VHandler(handler)
 }
@@ -93,16 +200,85 @@ func (r *Router) FilterFunc(f func(http.ResponseWriter, *http.Request) bool) {
 }
 
 // Match matches registered items against the request.
+// Items are tried in registration order, the first one matching wins.
 func (r *Router) Match(req *http.Request) *RouteItem {
-	for _, item := range r.items {
-		if item.Match(req) {
-			return item
+	return r.compiledTree().match(req)
+}
+
+// compiledTree returns the route tree, building it if the routes changed.
+func (r *Router) compiledTree() *routeTree {
+	r.treeLock.RLock()
+	tree := r.tree
+	r.treeLock.RUnlock()
+	if tree != nil {
+		return tree
+	}
+
+	r.treeLock.Lock()
+	defer r.treeLock.Unlock()
+	if r.tree == nil {
+		r.tree = newRouteTree(r.items)
+		r.tree.serve = wrapMiddlewares(VHandlerFunc(r.dispatch), r.middlewares)
+		if r.recovery != nil {
+			r.tree.serve = r.recovery(r.tree.serve)
 		}
 	}
-	return nil
+	return r.tree
+}
+
+// invalidate drops the route tree, it's rebuilt on the next Match.
+func (r *Router) invalidate() {
+	r.treeLock.Lock()
+	r.tree = nil
+	r.treeLock.Unlock()
+}
+
+// headResponseWriter drops the body written by a GET handler serving a HEAD
+// request.
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w *headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// Flush implements http.Flusher.
+func (w *headResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker.
+func (w *headResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("route: the ResponseWriter doesn't support Hijack")
+	}
+	return h.Hijack()
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (w *headResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// methodNotAllowed replies to the request with an HTTP 405 error.
+func methodNotAllowed(w http.ResponseWriter, req *http.Request, v url.Values) {
+	http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
 }
 
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.compiledTree().serve.VServeHTTP(w, withRouteMatch(req), nil)
+}
+
+// dispatch runs the filters, then the handler of the matched route.
+func (r *Router) dispatch(w http.ResponseWriter, req *http.Request, _ url.Values) {
+	if r.servePreflight(w, req) {
+		return
+	}
+
 	for _, filter := range r.filters {
 		if ok := filter.FilterHTTP(w, req); !ok {
 			return
@@ -112,6 +288,14 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	var handler VHandler
 	var routeParameters url.Values
 	routeitem := r.Match(req)
+	if routeitem == nil && req.Method == "HEAD" {
+		// GET routes serve HEAD requests too, without the body.
+		getreq := *req
+		getreq.Method = "GET"
+		if routeitem = r.Match(&getreq); routeitem != nil {
+			w = &headResponseWriter{w}
+		}
+	}
 	if routeitem != nil {
 		//fmt.Printf("router.ServHTTP, matched for url=%v\n", req.URL)
 		//{{处理 https和 http 的redirect
@@ -119,9 +303,12 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 		if redirectURL != "" {
 			//fmt.Printf("Router ServeHTTP redirectURL=%s\n", redirectURL)
-			http.Redirect(w, req, redirectURL, http.StatusSeeOther)
+			http.Redirect(w, req, redirectURL, r.getSchemeRedirectStatus())
 			return
 		}
+		if r.hsts != "" && routeitem.onlyscheme == "https" && r.RequestScheme(req) == "https" {
+			w.Header().Set("Strict-Transport-Security", r.hsts)
+		}
 		//}}
 
 		//{{处理 RedirectSlash
@@ -146,8 +333,38 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		}
 		//}}
 
-		handler = routeitem.CreateHandler(w, req)
 		routeParameters = routeitem.GetRouteParams(req)
+		req = setRouteMatch(req, routeitem, routeParameters)
+
+		if policy := routeitem.corsPolicy(); policy != nil {
+			policy.handleActual(w, req)
+		}
+
+		if routeitem.group != nil && !routeitem.group.filterHTTP(w, req) {
+			return
+		}
+
+		handler = r.compiledTree().handler(routeitem)
+	}
+
+	if handler == nil && routeitem == nil {
+		if allowed := r.compiledTree().allowedMethods(req); len(allowed) > 0 {
+			if matchInArray(allowed, "GET") && !matchInArray(allowed, "HEAD") {
+				allowed = append(allowed, "HEAD")
+			}
+			if !matchInArray(allowed, "OPTIONS") {
+				allowed = append(allowed, "OPTIONS")
+			}
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			if req.Method == "OPTIONS" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			handler = r.MethodNotAllowedVHandler
+			if handler == nil {
+				handler = VHandlerFunc(methodNotAllowed)
+			}
+		}
 	}
 
 	if handler == nil {
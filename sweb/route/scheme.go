@@ -0,0 +1,197 @@
+package route
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TrustedProxies are the networks of trusted reverse proxies, see
+// ParseTrustedProxies.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses networks in CIDR notation or single IPs, like
+// "10.0.0.0/8" or "::1". The route and ratelimit packages trust the
+// forwarded headers of the proxies parsed here.
+func ParseTrustedProxies(cidrs ...string) (TrustedProxies, error) {
+	nets := make(TrustedProxies, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("mux: invalid trusted proxy %q", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("mux: invalid trusted proxy %q: %v", cidr, err)
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets, nil
+}
+
+// Contains reports whether ip is in one of the networks.
+func (p TrustedProxies) Contains(ip net.IP) bool {
+	for _, ipnet := range p {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetTrustedProxies sets the networks, in CIDR notation or as single IPs,
+// of the reverse proxies allowed to tell the request scheme through the
+// Forwarded, X-Forwarded-Proto and X-Scheme headers. Other clients can't
+// spoof it, only req.TLS counts for them.
+//
+// Behind a TLS-terminating proxy, the proxy must be set here: otherwise
+// every request looks like plain HTTP, and the OnlyScheme("https") routes
+// redirect forever. The Router logs a warning the first time it ignores
+// these headers because no proxy is trusted.
+func (r *Router) SetTrustedProxies(cidrs ...string) error {
+	nets, err := ParseTrustedProxies(cidrs...)
+	if err != nil {
+		return err
+	}
+	r.trustedProxies = nets
+	return nil
+}
+
+// isTrustedProxy reports whether the request comes from a trusted proxy.
+func (r *Router) isTrustedProxy(req *http.Request) bool {
+	if len(r.trustedProxies) == 0 {
+		return false
+	}
+	host := req.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && r.trustedProxies.Contains(ip)
+}
+
+// RequestScheme returns "https" or "http", the scheme the client used.
+// Behind a trusted proxy, it's read from the Forwarded header (RFC 7239),
+// then X-Forwarded-Proto, then X-Scheme. Proxies append to these headers,
+// so the last value is the one added by the trusted proxy.
+func (r *Router) RequestScheme(req *http.Request) string {
+	if r.isTrustedProxy(req) {
+		if proto := forwardedProto(req.Header.Values("Forwarded")); proto != "" {
+			return proto
+		}
+		if proto := lastValue(req.Header.Values("X-Forwarded-Proto")); proto != "" {
+			return strings.ToLower(proto)
+		}
+		if proto := lastValue(req.Header.Values("X-Scheme")); proto != "" {
+			return strings.ToLower(proto)
+		}
+	} else if len(r.trustedProxies) == 0 && req.TLS == nil {
+		r.warnUntrustedScheme(req)
+	}
+	if req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// warnUntrustedScheme logs once that scheme headers are ignored because no
+// proxy is trusted, see SetTrustedProxies.
+func (r *Router) warnUntrustedScheme(req *http.Request) {
+	if req.Header.Get("Forwarded") == "" && req.Header.Get("X-Forwarded-Proto") == "" &&
+		req.Header.Get("X-Scheme") == "" {
+		return
+	}
+	r.schemeWarnOnce.Do(func() {
+		logger().Warnf("mux: ignoring the scheme headers of %s, call Router.SetTrustedProxies with the address of the proxy", req.RemoteAddr)
+	})
+}
+
+// forwardedProto returns the proto parameter of the last element of the
+// Forwarded headers, the one added by the proxy closest to the server.
+func forwardedProto(forwarded []string) string {
+	element := lastValue(forwarded)
+	if element == "" {
+		return ""
+	}
+	for _, pair := range strings.Split(element, ";") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) == 2 && strings.EqualFold(kv[0], "proto") {
+			return strings.ToLower(strings.Trim(kv[1], `"`))
+		}
+	}
+	return ""
+}
+
+// lastValue returns the last of the comma separated values of header lines.
+func lastValue(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	values := strings.Split(lines[len(lines)-1], ",")
+	return strings.TrimSpace(values[len(values)-1])
+}
+
+// schemeRedirectURL returns the request URL with the scheme and host of base,
+// base being like "https://example.com:8443" or "example.com:8443". With an
+// empty base, the request host is used without its port, the port of one
+// scheme being wrong for the other: the target is on the default port.
+func schemeRedirectURL(req *http.Request, scheme string, base string) string {
+	host := ""
+	if i := strings.Index(base, "://"); i >= 0 {
+		scheme, host = base[:i], strings.TrimRight(base[i+3:], "/")
+	} else {
+		host = strings.TrimRight(base, "/")
+	}
+	if host == "" {
+		host = getHost(req)
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+	}
+	requestURI := req.RequestURI
+	if !strings.HasPrefix(requestURI, "/") {
+		// Empty, or the absolute form sent to proxies.
+		requestURI = req.URL.RequestURI()
+	}
+	return scheme + "://" + host + requestURI
+}
+
+// SetSchemeRedirectStatus sets the status of the redirects enforcing the
+// OnlyScheme policy, 303 by default. Use 308 once HTTPS is there to stay.
+func (r *Router) SetSchemeRedirectStatus(status int) {
+	r.schemeRedirectStatus = status
+}
+
+func (r *Router) getSchemeRedirectStatus() int {
+	if r.schemeRedirectStatus == 0 {
+		return http.StatusSeeOther
+	}
+	return r.schemeRedirectStatus
+}
+
+// EnableHSTS adds a Strict-Transport-Security header to the HTTPS responses
+// of the routes with OnlyScheme("https"). A zero maxAge disables it.
+func (r *Router) EnableHSTS(maxAge time.Duration, includeSubDomains, preload bool) {
+	if maxAge <= 0 {
+		r.hsts = ""
+		return
+	}
+	hsts := fmt.Sprintf("max-age=%d", int64(maxAge/time.Second))
+	if includeSubDomains {
+		hsts += "; includeSubDomains"
+	}
+	if preload {
+		hsts += "; preload"
+	}
+	r.hsts = hsts
+}
@@ -0,0 +1,27 @@
+package route
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSchemeRedirectPort(t *testing.T) {
+	tests := []struct {
+		only, url, want string
+		router          *Router
+	}{
+		{"http", "https://example.com:8443/x?a=1", "http://example.com/x?a=1", NewRouter()},
+		{"https", "http://example.com:8080/x", "https://example.com/x", NewRouterWithHost("example.com:8080", "", true)},
+		{"https", "http://[::1]:8080/x", "https://[::1]/x", NewRouterWithHost("[::1]:8080", "", true)},
+		{"https", "http://example.com:8080/x", "https://example.com:8443/x",
+			NewRouterWithHost("example.com:8080", "example.com:8443", true)},
+	}
+	for _, tt := range tests {
+		tt.router.VGETfunc("/x", noopHandler).OnlyScheme(tt.only)
+		rec := httptest.NewRecorder()
+		tt.router.ServeHTTP(rec, httptest.NewRequest("GET", tt.url, nil))
+		if got := rec.Header().Get("Location"); got != tt.want {
+			t.Errorf("%s with OnlyScheme(%q): redirected to %q, want %q", tt.url, tt.only, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package route
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ----------------------------------------------------------------------------
+// routeTree
+// ----------------------------------------------------------------------------
+
+// routeTree is a radix tree compiled from the path templates of a Router.
+//
+// It narrows the routes that can possibly match a request path, so Router.Match
+// doesn't have to try every RouteItem in turn. Static parts of a template and
+// plain {name} variables are matched by the tree itself; a {name:pattern}
+// variable, or a {name} not followed by a slash, stops the walk and leaves the
+// rest of the path to the route's regexp.
+//
+// Candidates are always verified in registration order, so the first route
+// that matches wins, exactly as with a linear scan.
+type routeTree struct {
+	root  *treeNode
+	items []*RouteItem
+	// Routes without a path template, they are candidates for any request.
+	always []int
+	// Router.dispatch wrapped by the Router middlewares.
+	serve VHandler
+	// Route handlers wrapped by their middlewares.
+	handlers map[*RouteItem]VHandler
+}
+
+type leafKind int
+
+const (
+	leafExact  leafKind = iota // the path must end here
+	leafFuzzy                  // the path may end here, with an optional '/'
+	leafPrefix                 // anything may follow
+	leafRegexp                 // anything may follow, but the regexp decides
+)
+
+type treeLeaf struct {
+	index int
+	kind  leafKind
+}
+
+type treeNode struct {
+	// Static text consumed when entering the node.
+	prefix string
+	// Static children, no two share the first byte of their prefix.
+	children []*treeNode
+	// Child for a {name} variable, matching up to the next slash.
+	param  *treeNode
+	leaves []treeLeaf
+}
+
+type treeCandidate struct {
+	index       int
+	checkRegexp bool
+}
+
+func newRouteTree(items []*RouteItem) *routeTree {
+	t := &routeTree{
+		root:     &treeNode{},
+		items:    items,
+		handlers: make(map[*RouteItem]VHandler, len(items)),
+	}
+	for i, item := range items {
+		t.handlers[item] = item.chainHandler()
+		if item.regexp == nil || item.regexp.path == nil {
+			t.always = append(t.always, i)
+			continue
+		}
+		t.insert(i, item.regexp.path)
+	}
+	return t
+}
+
+// insert adds the path template of the route at index i.
+func (t *routeTree) insert(i int, rr *routeRegexp) {
+	tpl := rr.template
+	if rr.fuzzySlash && strings.HasSuffix(tpl, "/") {
+		tpl = tpl[:len(tpl)-1]
+	}
+	idxs, err := braceIndices(tpl)
+	if err != nil {
+		t.always = append(t.always, i)
+		return
+	}
+
+	n := t.root
+	var end int
+	for k := 0; k < len(idxs); k += 2 {
+		n = n.insertStatic(tpl[end:idxs[k]])
+		end = idxs[k+1]
+		parts := strings.SplitN(tpl[idxs[k]+1:end-1], ":", 2)
+		// Only a default variable followed by a slash (or nothing) is
+		// matched segment-wise, anything else needs the regexp.
+		if (len(parts) == 2 && parts[1] != defaultPathPattern) ||
+			(end < len(tpl) && tpl[end] != '/') {
+			n.leaves = append(n.leaves, treeLeaf{i, leafRegexp})
+			return
+		}
+		if n.param == nil {
+			n.param = &treeNode{}
+		}
+		n = n.param
+	}
+	n = n.insertStatic(tpl[end:])
+
+	kind := leafExact
+	if rr.matchPrefix {
+		kind = leafPrefix
+	} else if rr.fuzzySlash {
+		kind = leafFuzzy
+	}
+	n.leaves = append(n.leaves, treeLeaf{i, kind})
+}
+
+// insertStatic returns the node reached after consuming s, splitting or
+// creating static children as needed.
+func (n *treeNode) insertStatic(s string) *treeNode {
+	if s == "" {
+		return n
+	}
+	for k, child := range n.children {
+		if child.prefix[0] != s[0] {
+			continue
+		}
+		l := commonPrefixLen(child.prefix, s)
+		if l < len(child.prefix) {
+			split := &treeNode{prefix: child.prefix[:l], children: []*treeNode{child}}
+			child.prefix = child.prefix[l:]
+			n.children[k] = split
+			child = split
+		}
+		return child.insertStatic(s[l:])
+	}
+	child := &treeNode{prefix: s}
+	n.children = append(n.children, child)
+	return child
+}
+
+// lookup collects the routes that can match the remaining path.
+func (n *treeNode) lookup(path string, out []treeCandidate) []treeCandidate {
+	for _, leaf := range n.leaves {
+		switch leaf.kind {
+		case leafExact:
+			if path == "" {
+				out = append(out, treeCandidate{leaf.index, false})
+			}
+		case leafFuzzy:
+			if path == "" || path == "/" {
+				out = append(out, treeCandidate{leaf.index, false})
+			}
+		case leafPrefix:
+			out = append(out, treeCandidate{leaf.index, false})
+		case leafRegexp:
+			out = append(out, treeCandidate{leaf.index, true})
+		}
+	}
+	for _, child := range n.children {
+		if strings.HasPrefix(path, child.prefix) {
+			out = child.lookup(path[len(child.prefix):], out)
+			break
+		}
+	}
+	if n.param != nil {
+		i := strings.IndexByte(path, '/')
+		if i < 0 {
+			i = len(path)
+		}
+		if i > 0 {
+			out = n.param.lookup(path[i:], out)
+		}
+	}
+	return out
+}
+
+// candidates returns the routes that can match the request path, in
+// registration order.
+func (t *routeTree) candidates(req *http.Request) []treeCandidate {
+	candidates := t.root.lookup(req.URL.Path, nil)
+	for _, i := range t.always {
+		candidates = append(candidates, treeCandidate{i, true})
+	}
+	sort.Slice(candidates, func(a, b int) bool {
+		return candidates[a].index < candidates[b].index
+	})
+	return candidates
+}
+
+// match returns the first route, in registration order, matching the request.
+func (t *routeTree) match(req *http.Request) *RouteItem {
+	for _, c := range t.candidates(req) {
+		item := t.items[c.index]
+		if c.checkRegexp {
+			if item.Match(req) {
+				return item
+			}
+		} else if item.matchSkipping(req, item.regexp.path) {
+			return item
+		}
+	}
+	return nil
+}
+
+// handler returns the route handler wrapped by its middlewares.
+func (t *routeTree) handler(item *RouteItem) VHandler {
+	if h, ok := t.handlers[item]; ok {
+		return h
+	}
+	return item.chainHandler()
+}
+
+// allowedMethods returns the methods of the routes that would match the
+// request with another method.
+func (t *routeTree) allowedMethods(req *http.Request) []string {
+	var allowed []string
+	for _, c := range t.candidates(req) {
+		item := t.items[c.index]
+		skip := matcher(nil)
+		if !c.checkRegexp {
+			skip = item.regexp.path
+		}
+		if !item.matchIgnoringMethods(req, skip) {
+			continue
+		}
+		for _, method := range item.methods() {
+			if !matchInArray(allowed, method) {
+				allowed = append(allowed, method)
+			}
+		}
+	}
+	return allowed
+}
+
+// commonPrefixLen returns the length of the common prefix of a and b.
+func commonPrefixLen(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
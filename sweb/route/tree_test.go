@@ -0,0 +1,103 @@
+package route
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func noopHandler(w http.ResponseWriter, r *http.Request, v url.Values) {}
+
+// linearMatch is the matcher the tree replaced: every route in turn.
+func linearMatch(r *Router, req *http.Request) *RouteItem {
+	for _, item := range r.items {
+		if item.Match(req) {
+			return item
+		}
+	}
+	return nil
+}
+
+func newTestRouter() *Router {
+	r := NewRouter()
+	r.VGETfunc("/", noopHandler)
+	r.VGETfunc("/about", noopHandler)
+	r.VGETfunc("/users", noopHandler)
+	r.VPOSTfunc("/users", noopHandler)
+	r.VGETfunc("/users/{id:[0-9]+}", noopHandler)
+	r.VGETfunc("/users/{id}/posts", noopHandler)
+	r.VGETfunc("/users/{id}/posts/{post}", noopHandler)
+	r.VGETfunc("/users/me", noopHandler)
+	r.VGETfunc("/files/{name}.{ext}", noopHandler)
+	r.VGETfunc("/api/v1/{resource}/{id:int}", noopHandler)
+	r.VGETfunc("/api/v2/{resource}/{slug:slug}", noopHandler)
+	r.NewRouteItem().PathPrefix("/static/").VHandlerFunc(noopHandler)
+	r.NewRouteItem().Host("{sub}.example.com").Path("/host").VHandlerFunc(noopHandler)
+	r.NewRouteItem().Method("DELETE").VHandlerFunc(noopHandler)
+	admin := r.Group("/admin")
+	admin.VGETfunc("/", noopHandler)
+	admin.VGETfunc("/users/{id}", noopHandler)
+	for i := 0; i < 50; i++ {
+		r.VGETfunc(fmt.Sprintf("/section%d/{id}/detail", i), noopHandler)
+	}
+	return r
+}
+
+var testPaths = []string{
+	"/", "/about", "/about/", "/users", "/users/", "/users/42", "/users/abc",
+	"/users/42/posts", "/users/42/posts/7", "/users/me", "/files/a.txt",
+	"/files/a", "/api/v1/books/3", "/api/v1/books/x", "/api/v2/books/a-b",
+	"/static/css/site.css", "/static", "/host", "/admin", "/admin/",
+	"/admin/users/1", "/section7/1/detail", "/section49/x/detail",
+	"/section50/x/detail", "/nothing/here", "/users//posts",
+}
+
+func TestTreeMatchesLinear(t *testing.T) {
+	r := newTestRouter()
+	for _, method := range []string{"GET", "POST", "DELETE"} {
+		for _, host := range []string{"example.org", "www.example.com"} {
+			for _, path := range testPaths {
+				req := httptest.NewRequest(method, "http://"+host+path, nil)
+				got, want := r.Match(req), linearMatch(r, req)
+				if got != want {
+					t.Errorf("%s %s%s: tree matched %v, linear matched %v",
+						method, host, path, routeTemplate(got), routeTemplate(want))
+				}
+			}
+		}
+	}
+}
+
+func routeTemplate(item *RouteItem) string {
+	if item == nil {
+		return "<nil>"
+	}
+	return item.GetPathTemplate()
+}
+
+func benchmarkRequests() []*http.Request {
+	reqs := make([]*http.Request, len(testPaths))
+	for i, path := range testPaths {
+		reqs[i] = httptest.NewRequest("GET", "http://example.org"+path, nil)
+	}
+	return reqs
+}
+
+func BenchmarkMatch(b *testing.B) {
+	r := newTestRouter()
+	reqs := benchmarkRequests()
+	r.Match(reqs[0])
+
+	b.Run("tree", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			r.Match(reqs[i%len(reqs)])
+		}
+	})
+	b.Run("linear", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			linearMatch(r, reqs[i%len(reqs)])
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package route
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+type contextKey int
+
+const routeMatchKey contextKey = 0
+
+// routeMatch is stored in the request context by Router.ServeHTTP, and
+// filled once a route has matched. Being a pointer, the Router middlewares
+// see the route too once the next handler has returned.
+type routeMatch struct {
+	item   *RouteItem
+	params url.Values
+}
+
+// withRouteMatch returns the request with an empty routeMatch in its context.
+func withRouteMatch(req *http.Request) *http.Request {
+	ctx := context.WithValue(req.Context(), routeMatchKey, &routeMatch{})
+	return req.WithContext(ctx)
+}
+
+// setRouteMatch records the matched route and its parameters.
+func setRouteMatch(req *http.Request, item *RouteItem, params url.Values) *http.Request {
+	m, ok := req.Context().Value(routeMatchKey).(*routeMatch)
+	if !ok {
+		req = withRouteMatch(req)
+		m = req.Context().Value(routeMatchKey).(*routeMatch)
+	}
+	m.item, m.params = item, params
+	return req
+}
+
+// Vars returns the route parameters of the request, the same values passed
+// to the VHandler. It's nil if no route matched or the route has no
+// variables.
+func Vars(r *http.Request) url.Values {
+	if m, ok := r.Context().Value(routeMatchKey).(*routeMatch); ok {
+		return m.params
+	}
+	return nil
+}
+
+// CurrentRoute returns the route matched for the request, or nil.
+func CurrentRoute(r *http.Request) *RouteItem {
+	if m, ok := r.Context().Value(routeMatchKey).(*routeMatch); ok {
+		return m.item
+	}
+	return nil
+}
+
+// WrapHandlerAsV adapts a http.Handler, it reads the route parameters with
+// Vars.
+func WrapHandlerAsV(h http.Handler) VHandler {
+	return VHandlerFunc(func(w http.ResponseWriter, r *http.Request, v url.Values) {
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,140 @@
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+)
+
+// Walk calls f for each route, in the order they are tried. It stops at the
+// first error returned by f and returns it.
+func (r *Router) Walk(f func(*RouteItem) error) error {
+	for _, item := range r.items {
+		if err := f(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o EndSlashOption) String() string {
+	switch o {
+	case END_SLASH_FUZZY:
+		return "fuzzy"
+	case END_SLASH_REDIRECT:
+		return "redirect"
+	case END_SLASH_EXACT:
+		return "exact"
+	}
+	return fmt.Sprintf("EndSlashOption(%d)", int(o))
+}
+
+// GetPathTemplate returns the path template of the route, if any.
+func (r *RouteItem) GetPathTemplate() string {
+	if r.regexp == nil || r.regexp.path == nil {
+		return ""
+	}
+	return r.regexp.path.template
+}
+
+// GetHostTemplate returns the host template of the route, if any.
+func (r *RouteItem) GetHostTemplate() string {
+	if r.regexp == nil || r.regexp.host == nil {
+		return ""
+	}
+	return r.regexp.host.template
+}
+
+// IsPathPrefix reports whether the path template is matched as a prefix.
+func (r *RouteItem) IsPathPrefix() bool {
+	return r.regexp != nil && r.regexp.path != nil && r.regexp.path.matchPrefix
+}
+
+// GetMethods returns the methods the route is restricted to, nil for any.
+func (r *RouteItem) GetMethods() []string {
+	return r.methods()
+}
+
+// GetScheme returns the OnlyScheme policy of the route, "" for none.
+func (r *RouteItem) GetScheme() string {
+	return r.onlyscheme
+}
+
+// routeInfo describes a route in the route table.
+type routeInfo struct {
+	Index   int
+	Name    string   `json:",omitempty"`
+	Methods []string `json:",omitempty"`
+	Host    string   `json:",omitempty"`
+	Path    string   `json:",omitempty"`
+	Prefix  bool     `json:",omitempty"`
+	Scheme  string   `json:",omitempty"`
+	Slash   string
+	Handler bool
+	Error   string `json:",omitempty"`
+}
+
+func (r *Router) routeInfos() []routeInfo {
+	var infos []routeInfo
+	r.Walk(func(item *RouteItem) error {
+		info := routeInfo{
+			Index:   len(infos),
+			Name:    item.GetName(),
+			Methods: item.GetMethods(),
+			Host:    item.GetHostTemplate(),
+			Path:    item.GetPathTemplate(),
+			Prefix:  item.IsPathPrefix(),
+			Scheme:  item.GetScheme(),
+			Slash:   item.GetSlashOption().String(),
+			Handler: item.handler != nil,
+		}
+		if item.err != nil {
+			info.Error = item.err.Error()
+		}
+		infos = append(infos, info)
+		return nil
+	})
+	return infos
+}
+
+// RouteTableVHandler returns a handler listing the routes in the order they
+// are tried, as JSON if the request accepts it or has format=json in the
+// query, as text otherwise. It's meant for debugging, don't expose it.
+func (r *Router) RouteTableVHandler() VHandler {
+	return VHandlerFunc(func(w http.ResponseWriter, req *http.Request, v url.Values) {
+		infos := r.routeInfos()
+		if req.URL.Query().Get("format") == "json" ||
+			strings.Contains(req.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			enc.Encode(infos)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "#\tNAME\tMETHODS\tHOST\tPATH\tSCHEME\tSLASH\tHANDLER\tERROR")
+		for _, info := range infos {
+			path := info.Path
+			if info.Prefix {
+				path += "*"
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%t\t%s\n",
+				info.Index, dash(info.Name), dash(strings.Join(info.Methods, ",")),
+				dash(info.Host), dash(path), dash(info.Scheme), info.Slash,
+				info.Handler, info.Error)
+		}
+		tw.Flush()
+	})
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,86 @@
+package route
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// StatusWriter wraps a http.ResponseWriter to record the status and the
+// size of the response. It keeps http.Flusher and http.Hijacker working if
+// the wrapped writer supports them.
+type StatusWriter struct {
+	http.ResponseWriter
+	status     int
+	written    int64
+	compressed bool
+}
+
+// NewStatusWriter wraps w, or returns it if it's already a StatusWriter.
+func NewStatusWriter(w http.ResponseWriter) *StatusWriter {
+	if sw, ok := w.(*StatusWriter); ok {
+		return sw
+	}
+	return &StatusWriter{ResponseWriter: w}
+}
+
+func (w *StatusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+		enc := w.Header().Get("Content-Encoding")
+		w.compressed = enc != "" && enc != "identity"
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *StatusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// Status returns the status written, 0 if none yet.
+func (w *StatusWriter) Status() int {
+	return w.status
+}
+
+// Written returns the bytes of body written, after compression if any.
+func (w *StatusWriter) Written() int64 {
+	return w.written
+}
+
+// Compressed reports whether the response had a Content-Encoding.
+func (w *StatusWriter) Compressed() bool {
+	return w.compressed
+}
+
+// Flush implements http.Flusher.
+func (w *StatusWriter) Flush() {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker.
+func (w *StatusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("route: the ResponseWriter doesn't support Hijack")
+	}
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (w *StatusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,14 @@
+package server
+
+import (
+	"github.com/fwis/goweb/sweb/logs"
+)
+
+var logVar logs.Var
+
+func logger() logs.Logger { return logVar.Get() }
+
+// SetLogger sets the logger of the listeners, logs.Discard silences them.
+func SetLogger(l logs.Logger) {
+	logVar.Set(l)
+}
@@ -0,0 +1,301 @@
+// Package server runs the HTTP and HTTPS listeners of a route.Router:
+//
+//     r := route.NewRouterWithHost("example.com", "example.com", true)
+//     ...
+//     srv := server.New(r)
+//     srv.HTTPAddr = ":80"
+//     srv.HTTPSAddr = ":443"
+//     srv.CertFile, srv.KeyFile = "cert.pem", "key.pem"
+//     srv.Sessions = []session.SessionProvider{provider}
+//     log.Fatal(srv.Run())
+//
+// Run blocks until SIGINT or SIGTERM, then stops accepting connections, waits
+// for the requests in flight and persists the sessions before returning.
+// SIGHUP reloads the certificate files without dropping connections, it's
+// ignored when no HTTPS listener is configured.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fwis/goweb/session"
+)
+
+// DefaultShutdownTimeout is how long Run waits for the requests in flight
+// when ShutdownTimeout is 0.
+const DefaultShutdownTimeout = 30 * time.Second
+
+type Server struct {
+	// Handler serves the requests of both listeners, usually a route.Router.
+	Handler http.Handler
+	// Address of the HTTP listener, like ":80", none if "".
+	HTTPAddr string
+	// Address of the HTTPS listener, like ":443", none if "".
+	HTTPSAddr string
+	// PEM certificate and key of the HTTPS listener, reloaded on SIGHUP.
+	CertFile string
+	KeyFile  string
+	// Base TLS configuration, its certificates are replaced by CertFile.
+	TLSConfig *tls.Config
+	// If set, the HTTP listener redirects every request to HTTPS with a 308,
+	// instead of serving Handler. The target host is the request one, on the
+	// HTTPSAddr port.
+	RedirectHTTP bool
+	// Timeouts of the http.Server of each listener.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// How long to wait for the requests in flight on shutdown,
+	// DefaultShutdownTimeout if 0.
+	ShutdownTimeout time.Duration
+	// Providers whose PersistSessions is called once the listeners are
+	// drained.
+	Sessions []session.SessionProvider
+
+	lock    sync.Mutex
+	cert    *tls.Certificate
+	servers []*http.Server
+	stop    chan struct{}
+	stopped bool
+}
+
+func New(handler http.Handler) *Server {
+	return &Server{Handler: handler}
+}
+
+// ReloadCert loads CertFile and KeyFile, the new certificate is used by the
+// next TLS handshakes. On error the previous certificate is kept.
+func (s *Server) ReloadCert() error {
+	cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.cert = &cert
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *Server) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.cert == nil {
+		return nil, errors.New("server: no certificate loaded")
+	}
+	return s.cert, nil
+}
+
+func (s *Server) tlsConfig() *tls.Config {
+	var config *tls.Config
+	if s.TLSConfig != nil {
+		config = s.TLSConfig.Clone()
+	} else {
+		config = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	config.Certificates = nil
+	config.GetCertificate = s.getCertificate
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{"h2", "http/1.1"}
+	}
+	return config
+}
+
+func (s *Server) newHTTPServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: s.ReadHeaderTimeout,
+		ReadTimeout:       s.ReadTimeout,
+		WriteTimeout:      s.WriteTimeout,
+		IdleTimeout:       s.IdleTimeout,
+	}
+}
+
+// Run starts the listeners and blocks until Stop is called, a signal
+// SIGINT or SIGTERM is received, or a listener fails. It then shuts down
+// gracefully and persists the sessions.
+//
+// It returns nil after a graceful shutdown, or the listener error.
+func (s *Server) Run() error {
+	if s.HTTPAddr == "" && s.HTTPSAddr == "" {
+		return errors.New("server: no address to listen on")
+	}
+	if s.HTTPSAddr != "" {
+		if err := s.ReloadCert(); err != nil {
+			return err
+		}
+	}
+
+	// Listen before serving, so an address in use is returned right away.
+	type listener struct {
+		l   net.Listener
+		srv *http.Server
+	}
+	var listeners []listener
+	closeAll := func() {
+		for _, l := range listeners {
+			l.l.Close()
+		}
+	}
+	if s.HTTPAddr != "" {
+		l, err := net.Listen("tcp", s.HTTPAddr)
+		if err != nil {
+			return err
+		}
+		handler := s.Handler
+		if s.RedirectHTTP && s.HTTPSAddr != "" {
+			handler = s.redirectHandler()
+		}
+		listeners = append(listeners, listener{l, s.newHTTPServer(handler)})
+	}
+	if s.HTTPSAddr != "" {
+		l, err := net.Listen("tcp", s.HTTPSAddr)
+		if err != nil {
+			closeAll()
+			return err
+		}
+		srv := s.newHTTPServer(s.Handler)
+		srv.TLSConfig = s.tlsConfig()
+		listeners = append(listeners, listener{tls.NewListener(l, srv.TLSConfig), srv})
+	}
+
+	s.lock.Lock()
+	if s.stopped {
+		s.lock.Unlock()
+		closeAll()
+		return nil
+	}
+	s.stop = make(chan struct{})
+	s.servers = s.servers[:0]
+	for _, l := range listeners {
+		s.servers = append(s.servers, l.srv)
+	}
+	stop := s.stop
+	s.lock.Unlock()
+
+	errc := make(chan error, len(listeners))
+	for _, l := range listeners {
+		logger().Infof("server: listening on %s", l.l.Addr())
+		go func(l listener) {
+			errc <- l.srv.Serve(l.l)
+		}(l)
+	}
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigc)
+
+	var err error
+loop:
+	for {
+		select {
+		case sig := <-sigc:
+			if sig == syscall.SIGHUP {
+				if s.HTTPSAddr == "" || s.CertFile == "" {
+					logger().Infof("server: SIGHUP ignored, no certificate to reload")
+				} else if err := s.ReloadCert(); err != nil {
+					logger().Errorf("server: reloading the certificate: %v", err)
+				} else {
+					logger().Infof("server: certificate reloaded")
+				}
+				continue
+			}
+			logger().Infof("server: %v received, shutting down", sig)
+			break loop
+		case <-stop:
+			break loop
+		case err = <-errc:
+			logger().Errorf("server: %v", err)
+			break loop
+		}
+	}
+
+	if serr := s.shutdown(); err == nil && serr != nil {
+		err = serr
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+	return err
+}
+
+// Stop makes Run shut down gracefully, as on SIGTERM.
+func (s *Server) Stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stopped {
+		return
+	}
+	s.stopped = true
+	if s.stop != nil {
+		close(s.stop)
+	}
+}
+
+// shutdown drains the listeners, then persists the sessions even if the
+// drain timed out.
+func (s *Server) shutdown() error {
+	timeout := s.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	s.lock.Lock()
+	servers := s.servers
+	s.lock.Unlock()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(servers))
+	for i, srv := range servers {
+		wg.Add(1)
+		go func(i int, srv *http.Server) {
+			defer wg.Done()
+			if errs[i] = srv.Shutdown(ctx); errs[i] != nil {
+				srv.Close()
+			}
+		}(i, srv)
+	}
+	wg.Wait()
+
+	for _, p := range s.Sessions {
+		p.PersistSessions()
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// redirectHandler redirects to the same URL on the HTTPS listener.
+func (s *Server) redirectHandler() http.Handler {
+	_, port, _ := net.SplitHostPort(s.HTTPSAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
@@ -70,12 +70,21 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var gmfim map[string]*MemFileInfo = make(map[string]*MemFileInfo)
 var gmzflock sync.RWMutex
 
+// Hits and misses of the OpenMemZipFile cache.
+var gmzfhits, gmzfmisses int64
+
+// MemZipCacheStats returns the hits and misses of the OpenMemZipFile cache.
+func MemZipCacheStats() (hits, misses int64) {
+	return atomic.LoadInt64(&gmzfhits), atomic.LoadInt64(&gmzfmisses)
+}
+
 //TODO: 加锁保证数据完整性
 func OpenMemZipFile(path string, zip string) (*MemFile, error) {
 	osfile, e := os.Open(path)
@@ -97,8 +106,10 @@ func OpenMemZipFile(path string, zip string) (*MemFile, error) {
 	gmzflock.RUnlock()
 
 	if ok && cfi.ModTime() == modtime && cfi.fileSize == fileSize {
+		atomic.AddInt64(&gmzfhits, 1)
 		//fmt.Printf("read %s file %s from cache\n", zip, path)
 	} else {
+		atomic.AddInt64(&gmzfmisses, 1)
 		//fmt.Printf("NOT read %s file %s from cache\n", zip, path)
 		var content []byte
 		if zip == "gzip" {
@@ -3,8 +3,10 @@ package zip
 import (
 	"compress/flate"
 	"compress/gzip"
+	"io"
 	"net/http"
 	"strings"
+	"sync/atomic"
 )
 
 const (
@@ -31,6 +33,20 @@ func GetZipAcceptEncoding(r *http.Request) string {
 	}
 }
 
+// AddVary adds a field name to the Vary header, keeping the ones already
+// there, like Origin set for CORS.
+func AddVary(h http.Header, field string) {
+	for _, v := range h.Values(headerVary) {
+		for _, f := range strings.Split(v, ",") {
+			f = strings.TrimSpace(f)
+			if f == "*" || strings.EqualFold(f, field) {
+				return
+			}
+		}
+	}
+	h.Add(headerVary, field)
+}
+
 func CanZip(w http.ResponseWriter, r *http.Request) bool {
 	// Skip compression if the client doesn't accept gzip encoding.
 	if len(r.Header.Get(headerSecWebSocketKey)) > 0 {
@@ -45,12 +61,45 @@ func CanZip(w http.ResponseWriter, r *http.Request) bool {
 	return true
 }
 
+// Observer is called after GzipWrite and DeflateWrite, and after each write
+// to the writers of NewGzipWriter and NewDefalteWriter, with the size of the
+// content before and after compression.
+type Observer func(encoding string, uncompressed, compressed int64)
+
+var observer atomic.Value
+
+// SetObserver sets the Observer of compressions, nil to remove it.
+func SetObserver(f Observer) {
+	observer.Store(f)
+}
+
+func observe(encoding string, uncompressed int, compressed int64) {
+	if f, _ := observer.Load().(Observer); f != nil {
+		f(encoding, int64(uncompressed), compressed)
+	}
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	cw.n += int64(n)
+	return n, err
+}
+
 func GzipWrite(w http.ResponseWriter, level int, b []byte) (int, error) {
-	gz, err := gzip.NewWriterLevel(w, level)
+	cw := &countingWriter{w: w}
+	gz, err := gzip.NewWriterLevel(cw, level)
 	if err != nil {
 		return 0, err
 	}
-	return gzipWrite(w, gz, b)
+	n, err := gzipWrite(w, gz, b)
+	observe(ENCODING_GZIP, len(b), cw.n)
+	return n, err
 }
 
 func gzipWrite(w http.ResponseWriter, gz *gzip.Writer, b []byte) (int, error) {
@@ -58,7 +107,7 @@ func gzipWrite(w http.ResponseWriter, gz *gzip.Writer, b []byte) (int, error) {
 		w.Header().Set(headerContentType, http.DetectContentType(b))
 	}
 	w.Header().Set(headerContentEncoding, ENCODING_GZIP)
-	w.Header().Set(headerVary, headerAcceptEncoding)
+	AddVary(w.Header(), headerAcceptEncoding)
 	n, err := gz.Write(b)
 	if err == nil {
 		w.Header().Del(headerContentLength)
@@ -68,13 +117,15 @@ func gzipWrite(w http.ResponseWriter, gz *gzip.Writer, b []byte) (int, error) {
 }
 
 func NewGzipWriter(w http.ResponseWriter, level int) (http.ResponseWriter, error) {
-	gz, err := gzip.NewWriterLevel(w, level)
+	cw := &countingWriter{w: w}
+	gz, err := gzip.NewWriterLevel(cw, level)
 	if err != nil {
 		return nil, err
 	}
 
 	return &gzipResponseWriter{
 		gzipw:          gz,
+		cw:             cw,
 		ResponseWriter: w,
 	}, nil
 }
@@ -84,7 +135,7 @@ func deflateWrite(w http.ResponseWriter, dw *flate.Writer, b []byte) (int, error
 		w.Header().Set(headerContentType, http.DetectContentType(b))
 	}
 	w.Header().Set(headerContentEncoding, ENCODING_DEFLATE)
-	w.Header().Set(headerVary, headerAcceptEncoding)
+	AddVary(w.Header(), headerAcceptEncoding)
 	n, err := dw.Write(b)
 	if err == nil {
 		w.Header().Del(headerContentLength)
@@ -94,47 +145,68 @@ func deflateWrite(w http.ResponseWriter, dw *flate.Writer, b []byte) (int, error
 }
 
 func DeflateWrite(w http.ResponseWriter, level int, b []byte) (int, error) {
-	deflate, err := flate.NewWriter(w, level)
+	cw := &countingWriter{w: w}
+	deflate, err := flate.NewWriter(cw, level)
 	if err != nil {
 		return 0, err
 	}
-	return deflateWrite(w, deflate, b)
+	n, err := deflateWrite(w, deflate, b)
+	observe(ENCODING_DEFLATE, len(b), cw.n)
+	return n, err
 }
 
 func NewDefalteWriter(w http.ResponseWriter, level int) (http.ResponseWriter, error) {
-	deflate, err := flate.NewWriter(w, level)
+	cw := &countingWriter{w: w}
+	deflate, err := flate.NewWriter(cw, level)
 	if err != nil {
 		return nil, err
 	}
 
 	return &deflateResponseWriter{
 		deflatew:       deflate,
+		cw:             cw,
 		ResponseWriter: w,
 	}, nil
 }
 
 type gzipResponseWriter struct {
 	gzipw *gzip.Writer
+	cw    *countingWriter
 	http.ResponseWriter
 }
 
 func (grw gzipResponseWriter) Write(b []byte) (int, error) {
-	return gzipWrite(grw.ResponseWriter, grw.gzipw, b)
+	before := grw.cw.n
+	n, err := gzipWrite(grw.ResponseWriter, grw.gzipw, b)
+	observe(ENCODING_GZIP, n, grw.cw.n-before)
+	return n, err
 }
 
 func (grw gzipResponseWriter) Close() {
+	before := grw.cw.n
 	grw.gzipw.Close()
+	if grw.cw.n > before {
+		observe(ENCODING_GZIP, 0, grw.cw.n-before)
+	}
 }
 
 type deflateResponseWriter struct {
 	deflatew *flate.Writer
+	cw       *countingWriter
 	http.ResponseWriter
 }
 
 func (drw deflateResponseWriter) Write(b []byte) (int, error) {
-	return deflateWrite(drw.ResponseWriter, drw.deflatew, b)
+	before := drw.cw.n
+	n, err := deflateWrite(drw.ResponseWriter, drw.deflatew, b)
+	observe(ENCODING_DEFLATE, n, drw.cw.n-before)
+	return n, err
 }
 
 func (drw deflateResponseWriter) Close() {
+	before := drw.cw.n
 	drw.deflatew.Close()
+	if drw.cw.n > before {
+		observe(ENCODING_DEFLATE, 0, drw.cw.n-before)
+	}
 }